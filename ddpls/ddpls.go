@@ -2,12 +2,14 @@ package ddpls
 
 import (
 	"context"
+	"encoding/json"
+	"time"
 
 	"github.com/DDP-Projekt/DDPLS/documents"
 	"github.com/DDP-Projekt/DDPLS/handlers"
+	"github.com/DDP-Projekt/DDPLS/uri"
 	"github.com/tliron/glsp"
 	protocol "github.com/tliron/glsp/protocol_3_16"
-	lspserver "github.com/tliron/glsp/server"
 
 	// Must include a backend implementation. See kutil's logging/ for other options.
 	_ "github.com/tliron/commonlog/simple"
@@ -19,16 +21,35 @@ const (
 )
 
 type DDPLS struct {
-	handler          protocol.Handler
-	dm               *documents.DocumentManager
-	diagnosticSender handlers.DiagnosticSender
-	Server           *lspserver.Server
+	handler     protocol.Handler
+	dm          *documents.DocumentManager
+	diagnostics *handlers.DiagnosticScheduler
+	// the last semantic tokens per document, used for deltas
+	semanticTokens *handlers.SemanticTokensCache
+	// set according to the initializationOptions of the client
+	inlayHints *handlers.InlayHintOptions
+	// wether the client supports window/workDoneProgress/create
+	supportsWorkDoneProgress bool
+	// wether the client pulls diagnostics, in which case they are not pushed
+	supportsPullDiagnostics bool
+	// wether the client supports workspace/diagnostic/refresh
+	supportsDiagnosticRefresh bool
+	// wether workspace/didChangeWatchedFiles can be registered dynamically
+	supportsWatchedFilesRegistration bool
+	// sends requests to the client, set when the client is initialized
+	call glsp.CallFunc
+	// the context of the connection to the client
+	ctx context.Context
 }
 
 func NewDDPLS(ctx context.Context) *DDPLS {
 	ls := &DDPLS{
-		dm:               documents.NewDocumentManager(),
-		diagnosticSender: handlers.CreateSendDiagnostics(ctx),
+		dm:          documents.NewDocumentManager(),
+		diagnostics: handlers.NewDiagnosticScheduler(ctx),
+
+		semanticTokens: handlers.NewSemanticTokensCache(),
+		inlayHints:     handlers.NewInlayHintOptions(),
+		ctx:            ctx,
 	}
 
 	CustomRequests := []protocol.CustomRequestHandler{
@@ -36,30 +57,55 @@ func NewDDPLS(ctx context.Context) *DDPLS {
 			Func:   handlers.CreateAstRequestHandler(ls.dm),
 			Method: "ast/getTree",
 		},
+		{
+			Func:   handlers.CreateInlayHintRequestHandler(ls.dm, ls.inlayHints),
+			Method: "textDocument/inlayHint",
+		},
+		{
+			Func:   handlers.CreateDocumentDiagnosticRequestHandler(ls.dm),
+			Method: "textDocument/diagnostic",
+		},
+		{
+			Func:   handlers.CreateWorkspaceDiagnosticRequestHandler(ls.dm),
+			Method: "workspace/diagnostic",
+		},
 	}
 
 	ls.handler = protocol.Handler{
-		Initialize:                      ls.createInitialize(),
-		Initialized:                     initialized,
-		Shutdown:                        shutdown,
-		SetTrace:                        setTrace,
-		TextDocumentDidOpen:             handlers.CreateTextDocumentDidOpen(ls.dm, ls.diagnosticSender),
-		TextDocumentDidSave:             handlers.TextDocumentDidSave,
-		TextDocumentDidChange:           handlers.CreateTextDocumentDidChange(ls.dm, ls.diagnosticSender),
-		TextDocumentDidClose:            handlers.CreateTextDocumentDidClose(ls.dm),
-		TextDocumentSemanticTokensFull:  handlers.CreateTextDocumentSemanticTokensFull(ls.dm),
-		TextDocumentSemanticTokensRange: handlers.CreateSemanticTokensRange(ls.dm),
-		TextDocumentCompletion:          handlers.CreateTextDocumentCompletion(ls.dm),
-		TextDocumentHover:               handlers.CreateTextDocumentHover(ls.dm),
-		TextDocumentDefinition:          handlers.CreateTextDocumentDefinition(ls.dm),
-		TextDocumentFoldingRange:        handlers.CreateTextDocumentFoldingRange(ls.dm),
-		TextDocumentRename:              handlers.CreateTextDocumentRename(ls.dm),
-		TextDocumentPrepareRename:       handlers.CreateTextDocumentPrepareRename(ls.dm),
-		TextDocumentDocumentHighlight:   handlers.CreateTextDocumentDocumentHighlight(ls.dm),
-		CustomRequest:                   CustomRequests,
+		Initialize:                          ls.createInitialize(),
+		Initialized:                         ls.createInitialized(),
+		Shutdown:                            ls.createShutdown(),
+		Exit:                                ls.createExit(),
+		SetTrace:                            setTrace,
+		CancelRequest:                       handlers.CreateCancelRequest(),
+		TextDocumentDidOpen:                 handlers.CreateTextDocumentDidOpen(ls.dm, ls.scheduleDiagnostics),
+		TextDocumentDidSave:                 handlers.CreateTextDocumentDidSave(ls.dm, ls.refreshDiagnostics),
+		TextDocumentDidChange:               handlers.CreateTextDocumentDidChange(ls.dm, ls.scheduleDiagnostics),
+		TextDocumentDidClose:                handlers.CreateTextDocumentDidClose(ls.dm, ls.semanticTokens),
+		TextDocumentSemanticTokensFull:      handlers.CreateTextDocumentSemanticTokensFull(ls.dm, ls.semanticTokens),
+		TextDocumentSemanticTokensFullDelta: handlers.CreateTextDocumentSemanticTokensFullDelta(ls.dm, ls.semanticTokens),
+		TextDocumentSemanticTokensRange:     handlers.CreateSemanticTokensRange(ls.dm),
+		TextDocumentCompletion:              handlers.CreateTextDocumentCompletion(ls.dm),
+		TextDocumentHover:                   handlers.CreateTextDocumentHover(ls.dm),
+		TextDocumentDefinition:              handlers.CreateTextDocumentDefinition(ls.dm),
+		TextDocumentFoldingRange:            handlers.CreateTextDocumentFoldingRange(ls.dm),
+		TextDocumentRename:                  handlers.CreateTextDocumentRename(ls.dm),
+		TextDocumentPrepareRename:           handlers.CreateTextDocumentPrepareRename(ls.dm),
+		TextDocumentDocumentHighlight:       handlers.CreateTextDocumentDocumentHighlight(ls.dm),
+		TextDocumentReferences:              handlers.CreateTextDocumentReferences(ls.dm),
+		TextDocumentDocumentSymbol:          handlers.CreateTextDocumentDocumentSymbol(ls.dm),
+		WorkspaceSymbol:                     handlers.CreateWorkspaceSymbol(ls.dm),
+		TextDocumentSignatureHelp:           handlers.CreateTextDocumentSignatureHelp(ls.dm),
+		TextDocumentCodeAction:              handlers.CreateTextDocumentCodeAction(ls.dm),
+		TextDocumentFormatting:              handlers.CreateTextDocumentFormatting(ls.dm),
+		TextDocumentRangeFormatting:         handlers.CreateTextDocumentRangeFormatting(ls.dm),
+		TextDocumentPrepareCallHierarchy:    handlers.CreateTextDocumentPrepareCallHierarchy(ls.dm),
+		CallHierarchyIncomingCalls:          handlers.CreateCallHierarchyIncomingCalls(ls.dm),
+		CallHierarchyOutgoingCalls:          handlers.CreateCallHierarchyOutgoingCalls(ls.dm),
+		WorkspaceDidChangeWatchedFiles:      handlers.CreateWorkspaceDidChangeWatchedFiles(ls.dm, ls.refreshDiagnostics),
+		CustomRequest:                       CustomRequests,
 	}
 
-	ls.Server = lspserver.NewServer(&ls.handler, lsName, false)
 	return ls
 }
 
@@ -69,14 +115,69 @@ func (ls *DDPLS) createInitialize() protocol.InitializeFunc {
 			handlers.SupportsSnippets = *params.Capabilities.TextDocument.Completion.CompletionItem.SnippetSupport
 		}
 
+		if params.Capabilities.Window != nil && params.Capabilities.Window.WorkDoneProgress != nil {
+			ls.supportsWorkDoneProgress = *params.Capabilities.Window.WorkDoneProgress
+		}
+
+		if workspace := params.Capabilities.Workspace; workspace != nil && workspace.DidChangeWatchedFiles != nil && workspace.DidChangeWatchedFiles.DynamicRegistration != nil {
+			ls.supportsWatchedFilesRegistration = *workspace.DidChangeWatchedFiles.DynamicRegistration
+		}
+
+		// protocol_3_16 does not know the diagnostic and position encoding capabilities of LSP 3.17
+		var capabilities317 struct {
+			Capabilities struct {
+				General struct {
+					PositionEncodings []string `json:"positionEncodings"`
+				} `json:"general"`
+				TextDocument struct {
+					Diagnostic *json.RawMessage `json:"diagnostic"`
+				} `json:"textDocument"`
+				Workspace struct {
+					Diagnostics struct {
+						RefreshSupport bool `json:"refreshSupport"`
+					} `json:"diagnostics"`
+				} `json:"workspace"`
+			} `json:"capabilities"`
+		}
+		if err := json.Unmarshal(context.Params, &capabilities317); err == nil {
+			ls.supportsPullDiagnostics = capabilities317.Capabilities.TextDocument.Diagnostic != nil
+			ls.supportsDiagnosticRefresh = capabilities317.Capabilities.Workspace.Diagnostics.RefreshSupport
+		}
+		positionEncoding := handlers.NegotiatePositionEncoding(capabilities317.Capabilities.General.PositionEncodings)
+		ls.dm.SetPositionEncoding(positionEncoding)
+
+		folders := make([]string, 0, len(params.WorkspaceFolders))
+		for _, folder := range params.WorkspaceFolders {
+			folders = append(folders, uri.FromURI(folder.URI).Filepath())
+		}
+		if len(folders) == 0 && params.RootURI != nil {
+			folders = append(folders, uri.FromURI(*params.RootURI).Filepath())
+		}
+		ls.dm.SetWorkspaceFolders(folders)
+
+		var initOptions struct {
+			InlayHints       *handlers.InlayHintOptions `json:"inlayHints"`
+			DiagnosticsDelay *int                       `json:"diagnosticsDelay"` // in milliseconds
+		}
+		initOptions.InlayHints = ls.inlayHints
+		if data, err := json.Marshal(params.InitializationOptions); err == nil {
+			json.Unmarshal(data, &initOptions)
+		}
+		if initOptions.DiagnosticsDelay != nil {
+			ls.diagnostics.SetDelay(time.Duration(*initOptions.DiagnosticsDelay) * time.Millisecond)
+		}
+
 		capabilities := ls.handler.CreateServerCapabilities()
+		temp := true
 		capabilities.SemanticTokensProvider = protocol.SemanticTokensRegistrationOptions{
 			SemanticTokensOptions: protocol.SemanticTokensOptions{
 				Legend: protocol.SemanticTokensLegend{
 					TokenTypes:     tokenTypeLegend(),
 					TokenModifiers: tokenModifierLegend(),
 				},
-				Full:  true,
+				Full: protocol.SemanticDelta{
+					Delta: &temp,
+				},
 				Range: true,
 			},
 		}
@@ -87,16 +188,38 @@ func (ls *DDPLS) createInitialize() protocol.InitializeFunc {
 				".",
 			},
 		}
-		temp := true
+		capabilities.SignatureHelpProvider = &protocol.SignatureHelpOptions{
+			TriggerCharacters: []string{
+				" ",
+				",",
+			},
+		}
+		capabilities.CodeActionProvider = &protocol.CodeActionOptions{
+			CodeActionKinds: []protocol.CodeActionKind{
+				protocol.CodeActionKindQuickFix,
+			},
+		}
 		capabilities.RenameProvider = &protocol.RenameOptions{
 			PrepareProvider: &temp,
 		}
 		capabilities.DocumentHighlightProvider = &protocol.DocumentHighlightOptions{
 			WorkDoneProgressOptions: protocol.WorkDoneProgressOptions{WorkDoneProgress: &temp},
 		}
+		var diagnosticProvider *handlers.DiagnosticOptions
+		if ls.supportsPullDiagnostics {
+			diagnosticProvider = &handlers.DiagnosticOptions{
+				InterFileDependencies: true,
+				WorkspaceDiagnostics:  true,
+			}
+		}
 		version := version
 		return protocol.InitializeResult{
-			Capabilities: capabilities,
+			Capabilities: serverCapabilities{
+				ServerCapabilities: capabilities,
+				PositionEncoding:   positionEncoding,
+				InlayHintProvider:  true,
+				DiagnosticProvider: diagnosticProvider,
+			},
 			ServerInfo: &protocol.InitializeResultServerInfo{
 				Name:    lsName,
 				Version: &version,
@@ -105,6 +228,31 @@ func (ls *DDPLS) createInitialize() protocol.InitializeFunc {
 	})
 }
 
+// adds the capabilities of LSP 3.17 that protocol_3_16 does not know about
+type serverCapabilities struct {
+	protocol.ServerCapabilities
+	PositionEncoding   documents.PositionEncoding  `json:"positionEncoding"`
+	InlayHintProvider  bool                        `json:"inlayHintProvider,omitempty"`
+	DiagnosticProvider *handlers.DiagnosticOptions `json:"diagnosticProvider,omitempty"`
+}
+
+// diagnostics are only pushed to clients that do not pull them
+// clients that pull them are asked to pull again if the change affects the documents that import vscURI
+func (ls *DDPLS) scheduleDiagnostics(dm *documents.DocumentManager, notify glsp.NotifyFunc, vscURI string, delay bool) {
+	if !ls.supportsPullDiagnostics {
+		ls.diagnostics.Schedule(dm, notify, vscURI, delay)
+	} else if len(dm.Dependents(vscURI)) > 0 {
+		ls.refreshDiagnostics()
+	}
+}
+
+// asks clients that pull diagnostics to pull them again
+func (ls *DDPLS) refreshDiagnostics() {
+	if ls.supportsPullDiagnostics && ls.supportsDiagnosticRefresh && ls.call != nil {
+		handlers.RefreshDiagnostics(ls.call)
+	}
+}
+
 // helper for semantic token
 func tokenTypeLegend() []string {
 	legend := make([]string, len(handlers.AllTokenTypes))
@@ -123,12 +271,30 @@ func tokenModifierLegend() []string {
 	return legend
 }
 
-func initialized(context *glsp.Context, params *protocol.InitializedParams) error {
-	return nil
+func (ls *DDPLS) createInitialized() protocol.InitializedFunc {
+	return handlers.RecoverErr(func(context *glsp.Context, params *protocol.InitializedParams) error {
+		ls.call = context.Call
+		if ls.supportsWatchedFilesRegistration {
+			handlers.RegisterWatchedFiles(context)
+		}
+		handlers.IndexWorkspace(context, ls.dm, ls.supportsWorkDoneProgress, ls.refreshDiagnostics)
+		return nil
+	})
 }
 
-func shutdown(context *glsp.Context) error {
-	return nil
+func (ls *DDPLS) createShutdown() protocol.ShutdownFunc {
+	return func(context *glsp.Context) error {
+		ls.diagnostics.Shutdown()
+		return nil
+	}
+}
+
+func (ls *DDPLS) createExit() protocol.ExitFunc {
+	return func(context *glsp.Context) error {
+		// exit may come without a shutdown before
+		ls.diagnostics.Shutdown()
+		return nil
+	}
 }
 
 func setTrace(context *glsp.Context, params *protocol.SetTraceParams) error {
@@ -0,0 +1,108 @@
+package ddpls
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/DDP-Projekt/DDPLS/handlers"
+	"github.com/DDP-Projekt/DDPLS/log"
+	"github.com/sourcegraph/jsonrpc2"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// serves the language server on stdin and stdout until the connection is closed
+func (ls *DDPLS) RunStdio() {
+	log.Infof("reading from stdin, writing to stdout")
+	conn := jsonrpc2.NewConn(ls.ctx, jsonrpc2.NewBufferedStream(stdrwc{}, jsonrpc2.VSCodeObjectCodec{}), ls)
+	<-conn.DisconnectNotify()
+	log.Infof("stdin/stdout connection closed")
+}
+
+// dispatches the messages of the client
+// glsp handles one message after the other, so a long request would block all others
+// and $/cancelRequest would only arrive after the request it cancels was handled
+// instead, notifications and initialize are still handled in order,
+// but every other request in its own goroutine
+func (ls *DDPLS) Handle(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	handler := jsonrpc2.HandlerWithError(ls.handle)
+	if req.Notif || req.Method == protocol.MethodInitialize {
+		handler.Handle(ctx, conn, req)
+		return
+	}
+	go handler.Handle(ctx, conn, req)
+}
+
+func (ls *DDPLS) handle(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) (any, error) {
+	// ctx is the context of the connection, so requests to the client
+	// do not fail when the request that sent them finished
+	glspContext := &glsp.Context{
+		Method: req.Method,
+		Notify: func(method string, params any) {
+			if err := conn.Notify(ctx, method, params); err != nil {
+				log.Errorf("%s", err)
+			}
+		},
+		Call: func(method string, params any, result any) {
+			if err := conn.Call(ctx, method, params, result); err != nil {
+				log.Errorf("%s", err)
+			}
+		},
+	}
+	if req.Params != nil {
+		glspContext.Params = *req.Params
+	}
+
+	if !req.Notif {
+		done := handlers.StartRequest(ctx, req.ID, glspContext)
+		defer done()
+	}
+
+	result, validMethod, validParams, err := ls.handler.Handle(glspContext)
+	if req.Method == protocol.MethodExit {
+		return nil, conn.Close()
+	}
+
+	var rpcErr *jsonrpc2.Error
+	switch {
+	case !validMethod:
+		return nil, &jsonrpc2.Error{
+			Code:    jsonrpc2.CodeMethodNotFound,
+			Message: fmt.Sprintf("method not supported: %s", req.Method),
+		}
+	case !validParams:
+		rpcErr = &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams}
+		if err != nil {
+			rpcErr.Message = err.Error()
+		}
+		return nil, rpcErr
+	case errors.As(err, &rpcErr):
+		return nil, rpcErr
+	case err != nil:
+		return nil, &jsonrpc2.Error{
+			Code:    jsonrpc2.CodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+	return result, nil
+}
+
+// stdin and stdout as io.ReadWriteCloser
+type stdrwc struct{}
+
+func (stdrwc) Read(p []byte) (int, error) {
+	return os.Stdin.Read(p)
+}
+
+func (stdrwc) Write(p []byte) (int, error) {
+	return os.Stdout.Write(p)
+}
+
+func (stdrwc) Close() error {
+	if err := os.Stdin.Close(); err != nil {
+		return err
+	}
+	return os.Stdout.Close()
+}
@@ -0,0 +1,403 @@
+package documents
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/DDP-Projekt/DDPLS/log"
+	"github.com/DDP-Projekt/Kompilierer/src/ast"
+	"github.com/DDP-Projekt/Kompilierer/src/ddperror"
+	"github.com/DDP-Projekt/Kompilierer/src/token"
+)
+
+// has to be increased whenever ModuleSummary or the cache file layout changes
+const cacheFormatVersion = 2
+
+// what is known about a module without keeping its ast
+// summaries are persisted in the cache directory,
+// so that the workspace index can warm-start from them
+type ModuleSummary struct {
+	FileName     string
+	Declarations []DeclSummary      // the top level declarations
+	Imports      []string           // the files imported directly
+	References   []ReferenceSummary // references to declarations of other modules
+	Diagnostics  []ddperror.Error   // the errors of the module itself
+}
+
+type DeclKind int
+
+const (
+	DeclKindVar DeclKind = iota
+	DeclKindConst
+	DeclKindFunc
+	DeclKindOperator
+	DeclKindStruct
+	DeclKindTypeDef
+	DeclKindTypeAlias
+)
+
+type DeclSummary struct {
+	Name    string
+	Kind    DeclKind
+	Public  bool
+	Range   token.Range // the range of the name
+	Aliases []string    // the aliases of functions and structs without quotes
+}
+
+type ReferenceSummary struct {
+	Name  string      // the name of the referenced declaration
+	File  string      // the module of the referenced declaration
+	Range token.Range // the range of the reference
+}
+
+// reports wether the summary belongs to the file at path
+// or its module imports that file or references one of its declarations
+// only those modules can contain references to the declarations of path
+func (summary *ModuleSummary) references(path string) bool {
+	return summary.FileName == path || slices.Contains(summary.Imports, path) ||
+		slices.ContainsFunc(summary.References, func(ref ReferenceSummary) bool {
+			return ref.File == path
+		})
+}
+
+// creates the summary of mod
+// errs are the errors reported while parsing mod
+func summarize(mod *ast.Module, errs []ddperror.Error) *ModuleSummary {
+	summary := &ModuleSummary{
+		FileName:     mod.FileName,
+		Declarations: make([]DeclSummary, 0),
+		Imports:      make([]string, 0, len(mod.Imports)),
+		References:   make([]ReferenceSummary, 0),
+		Diagnostics:  make([]ddperror.Error, 0, len(errs)),
+	}
+
+	for _, stmt := range mod.Ast.Statements {
+		if declStmt, ok := stmt.(*ast.DeclStmt); ok {
+			if decl, ok := summarizeDecl(declStmt.Decl); ok {
+				summary.Declarations = append(summary.Declarations, decl)
+			}
+		}
+	}
+
+	for _, imprt := range mod.Imports {
+		for _, imported := range imprt.Modules {
+			summary.Imports = append(summary.Imports, imported.FileName)
+		}
+	}
+
+	addReference := func(decl ast.Declaration, rang token.Range) {
+		if decl != nil && decl.Module() != nil && decl.Module() != mod {
+			summary.References = append(summary.References, ReferenceSummary{
+				Name:  decl.Name(),
+				File:  decl.Module().FileName,
+				Range: rang,
+			})
+		}
+	}
+	ast.VisitModule(mod, ast.IdentVisitorFunc(func(ident *ast.Ident) ast.VisitResult {
+		addReference(ident.Declaration, ident.GetRange())
+		return ast.VisitRecurse
+	}))
+	ast.VisitModule(mod, ast.FuncCallVisitorFunc(func(call *ast.FuncCall) ast.VisitResult {
+		if call.Func != nil {
+			addReference(call.Func, call.Range)
+		}
+		return ast.VisitRecurse
+	}))
+
+	for _, err := range errs {
+		if err.File == mod.FileName {
+			summary.Diagnostics = append(summary.Diagnostics, err)
+		}
+	}
+	return summary
+}
+
+func summarizeDecl(decl ast.Declaration) (DeclSummary, bool) {
+	aliasStrings := func(aliases []ast.Alias) []string {
+		result := make([]string, 0, len(aliases))
+		for _, alias := range aliases {
+			original := alias.GetOriginal()
+			result = append(result, ast.TrimStringLit(&original))
+		}
+		return result
+	}
+
+	switch decl := decl.(type) {
+	case *ast.VarDecl:
+		return DeclSummary{Name: decl.Name(), Kind: DeclKindVar, Public: decl.IsPublic, Range: decl.NameTok.Range}, true
+	case *ast.ConstDecl:
+		return DeclSummary{Name: decl.Name(), Kind: DeclKindConst, Public: decl.IsPublic, Range: decl.NameTok.Range}, true
+	case *ast.FuncDecl:
+		aliases := make([]ast.Alias, 0, len(decl.Aliases))
+		for _, alias := range decl.Aliases {
+			aliases = append(aliases, alias)
+		}
+		kind := DeclKindFunc
+		if ast.IsOperatorOverload(decl) {
+			kind = DeclKindOperator
+		}
+		return DeclSummary{Name: decl.Name(), Kind: kind, Public: decl.IsPublic, Range: decl.NameTok.Range, Aliases: aliasStrings(aliases)}, true
+	case *ast.StructDecl:
+		aliases := make([]ast.Alias, 0, len(decl.Aliases))
+		for _, alias := range decl.Aliases {
+			aliases = append(aliases, alias)
+		}
+		return DeclSummary{Name: decl.Name(), Kind: DeclKindStruct, Public: decl.IsPublic, Range: decl.NameTok.Range, Aliases: aliasStrings(aliases)}, true
+	case *ast.TypeDefDecl:
+		return DeclSummary{Name: decl.Name(), Kind: DeclKindTypeDef, Public: decl.IsPublic, Range: decl.NameTok.Range}, true
+	case *ast.TypeAliasDecl:
+		return DeclSummary{Name: decl.Name(), Kind: DeclKindTypeAlias, Public: decl.IsPublic, Range: decl.NameTok.Range}, true
+	}
+	return DeclSummary{}, false
+}
+
+// the layout of a file in the cache directory
+type cacheFile struct {
+	Format      int
+	Kompilierer string
+	Checksum    string          // sha256 of Summary, to detect corrupted files
+	Summary     json.RawMessage // the encoded ModuleSummary
+	// the content hashes of the files the module imports directly or indirectly
+	// References and Diagnostics depend on them, so the summary is outdated once one of them changed
+	Imports map[string]string
+}
+
+var (
+	cacheDirOnce sync.Once
+	cacheDir     string // empty if there is no cache directory
+)
+
+// returns the directory in which the summaries are stored
+// or "" if the user has no cache directory
+func CacheDir() string {
+	cacheDirOnce.Do(func() {
+		if dir, err := os.UserCacheDir(); err == nil {
+			cacheDir = filepath.Join(dir, "ddpls")
+		} else {
+			log.Warningf("no cache directory available: %s", err)
+		}
+	})
+	return cacheDir
+}
+
+// removes all cached summaries
+func CleanCache() error {
+	if CacheDir() == "" {
+		return errors.New("no cache directory available")
+	}
+	return os.RemoveAll(CacheDir())
+}
+
+// the version of the Kompilierer the server was built with
+// summaries of another version might be different and are not used
+var kompiliererVersion = func() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == "github.com/DDP-Projekt/Kompilierer" {
+			if dep.Replace != nil {
+				dep = dep.Replace
+			}
+			return dep.Version + dep.Sum
+		}
+	}
+	return "unknown"
+}()
+
+// returns the path of the cache file for the file at path with the given content
+func cachePath(path string, content []byte) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%d\x00%s\x00%s\x00", cacheFormatVersion, kompiliererVersion, path)
+	hash.Write(content)
+	return filepath.Join(CacheDir(), hex.EncodeToString(hash.Sum(nil))+".json")
+}
+
+// returns the cached summary of the file at path with the given content
+// if one of the files it imports changed since the summary was stored, there is none
+// corrupted or outdated cache files are removed
+func loadSummary(path string, content []byte) (*ModuleSummary, bool) {
+	if CacheDir() == "" {
+		return nil, false
+	}
+
+	file := cachePath(path, content)
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, false
+	}
+
+	var cached cacheFile
+	if err := json.Unmarshal(data, &cached); err != nil ||
+		cached.Format != cacheFormatVersion ||
+		cached.Kompilierer != kompiliererVersion ||
+		cached.Checksum != checksum(cached.Summary) {
+		log.Warningf("removing invalid cache file %s", file)
+		os.Remove(file)
+		return nil, false
+	}
+
+	var summary ModuleSummary
+	if err := json.Unmarshal(cached.Summary, &summary); err != nil || summary.FileName != path {
+		log.Warningf("removing invalid cache file %s", file)
+		os.Remove(file)
+		return nil, false
+	}
+
+	// the file is overwritten when the summary is stored again
+	for imported, hash := range cached.Imports {
+		if contentHash(imported) != hash {
+			return nil, false
+		}
+	}
+
+	// the file is still used, so it must not be pruned
+	now := time.Now()
+	os.Chtimes(file, now, now)
+	return &summary, true
+}
+
+// cache files that were not used for this long are removed by pruneCache
+// they belong to files that changed while the server was not running or to old workspaces
+const maxCacheAge = 30 * 24 * time.Hour
+
+// removes the cache files that were not used for maxCacheAge
+func pruneCache() {
+	if CacheDir() == "" {
+		return
+	}
+
+	entries, err := os.ReadDir(CacheDir())
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() || time.Since(info.ModTime()) < maxCacheAge {
+			continue
+		}
+		removeCacheFile(filepath.Join(CacheDir(), entry.Name()))
+	}
+}
+
+// removes a file from the cache directory
+// file may be empty or no longer exist
+func removeCacheFile(file string) {
+	if file == "" {
+		return
+	}
+	if err := os.Remove(file); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Warningf("could not remove cache file %s: %s", file, err)
+	}
+}
+
+// stores the summary of the file at path with the given content
+// imports are the filepaths of the modules it imports directly or indirectly
+func storeSummary(path string, content []byte, summary *ModuleSummary, imports map[string]struct{}) {
+	if CacheDir() == "" {
+		return
+	}
+
+	encoded, err := json.Marshal(summary)
+	if err != nil {
+		log.Warningf("could not encode the summary of %s: %s", path, err)
+		return
+	}
+	data, err := json.Marshal(cacheFile{
+		Format:      cacheFormatVersion,
+		Kompilierer: kompiliererVersion,
+		Checksum:    checksum(encoded),
+		Summary:     encoded,
+		Imports:     importHashes(imports),
+	})
+	if err != nil {
+		log.Warningf("could not encode the summary of %s: %s", path, err)
+		return
+	}
+
+	if err := os.MkdirAll(CacheDir(), 0o755); err != nil {
+		log.Warningf("could not create the cache directory: %s", err)
+		return
+	}
+	// write to a temporary file first, so that readers never see a partially written file
+	tmp, err := os.CreateTemp(CacheDir(), "*.tmp")
+	if err != nil {
+		log.Warningf("could not write the summary of %s: %s", path, err)
+		return
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), cachePath(path, content))
+	}
+	if err != nil {
+		log.Warningf("could not write the summary of %s: %s", path, err)
+		os.Remove(tmp.Name())
+	}
+}
+
+func checksum(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+// the content hashes of files by their filepath,
+// so that files imported by many modules (e.g. from the Duden) are only read once
+var contentHashes = struct {
+	sync.Mutex
+	hashes map[string]fileHash
+}{hashes: make(map[string]fileHash)}
+
+type fileHash struct {
+	modTime time.Time // modification time of the file when it was hashed
+	hash    string
+}
+
+// returns the checksum of the content of the file at path or "" if it cannot be read
+func contentHash(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+
+	contentHashes.Lock()
+	cached, ok := contentHashes.hashes[path]
+	contentHashes.Unlock()
+	if ok && cached.modTime.Equal(info.ModTime()) {
+		return cached.hash
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	hash := checksum(content)
+
+	contentHashes.Lock()
+	defer contentHashes.Unlock()
+	contentHashes.hashes[path] = fileHash{modTime: info.ModTime(), hash: hash}
+	return hash
+}
+
+// returns the content hashes of the files at paths
+func importHashes(paths map[string]struct{}) map[string]string {
+	hashes := make(map[string]string, len(paths))
+	for path := range paths {
+		hashes[path] = contentHash(path)
+	}
+	return hashes
+}
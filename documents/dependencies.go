@@ -0,0 +1,117 @@
+package documents
+
+import (
+	"maps"
+
+	"github.com/DDP-Projekt/Kompilierer/src/ast"
+)
+
+// the imports between files, built from the parsed modules
+// used to find the documents that have to be reparsed when one of their imports changes
+type dependencyGraph struct {
+	imports map[string]map[string]struct{} // the files a file imports directly
+}
+
+func newDependencyGraph() *dependencyGraph {
+	return &dependencyGraph{
+		imports: make(map[string]map[string]struct{}),
+	}
+}
+
+// replaces the edges of mod and all modules it imports with their current imports
+// the edges of open documents other than mod are only updated when they are parsed themselves,
+// as mod might still reference an outdated version of them
+// reports wether the imports of mod changed
+func (graph *dependencyGraph) update(mod *ast.Module, openDocs map[string]*DocumentState) bool {
+	oldImports := graph.imports[mod.FileName]
+
+	visited := make(map[*ast.Module]struct{})
+	var visit func(mod *ast.Module)
+	visit = func(mod *ast.Module) {
+		if _, ok := visited[mod]; ok {
+			return
+		}
+		visited[mod] = struct{}{}
+
+		imports := make(map[string]struct{}, len(mod.Imports))
+		for _, imprt := range mod.Imports {
+			for _, imported := range imprt.Modules {
+				imports[imported.FileName] = struct{}{}
+				if _, isOpen := openDocs[imported.FileName]; !isOpen {
+					visit(imported)
+				}
+			}
+		}
+		graph.imports[mod.FileName] = imports
+	}
+	visit(mod)
+
+	return !maps.Equal(oldImports, graph.imports[mod.FileName])
+}
+
+// returns all files that import path directly or indirectly
+func (graph *dependencyGraph) dependents(path string) map[string]struct{} {
+	importedBy := make(map[string][]string, len(graph.imports))
+	for file, imports := range graph.imports {
+		for imported := range imports {
+			importedBy[imported] = append(importedBy[imported], file)
+		}
+	}
+
+	dependents := make(map[string]struct{})
+	queue := []string{path}
+	for len(queue) > 0 {
+		file := queue[0]
+		queue = queue[1:]
+		for _, dependent := range importedBy[file] {
+			if _, ok := dependents[dependent]; !ok && dependent != path {
+				dependents[dependent] = struct{}{}
+				queue = append(queue, dependent)
+			}
+		}
+	}
+	return dependents
+}
+
+// returns all files that path imports directly or indirectly
+func (graph *dependencyGraph) imported(path string) map[string]struct{} {
+	imported := make(map[string]struct{})
+	queue := []string{path}
+	for len(queue) > 0 {
+		file := queue[0]
+		queue = queue[1:]
+		for imp := range graph.imports[file] {
+			if _, ok := imported[imp]; !ok {
+				imported[imp] = struct{}{}
+				queue = append(queue, imp)
+			}
+		}
+	}
+	return imported
+}
+
+// returns the files on a chain of imports from -> ... -> to
+// or nil if to is not imported by from directly or indirectly
+func (graph *dependencyGraph) findPath(from, to string) []string {
+	previous := map[string]string{from: ""}
+	queue := []string{from}
+	for len(queue) > 0 {
+		file := queue[0]
+		queue = queue[1:]
+		if file == to {
+			path := []string{}
+			for ; file != ""; file = previous[file] {
+				path = append([]string{file}, path...)
+			}
+			return path
+		}
+
+		for imported := range graph.imports[file] {
+			if _, ok := previous[imported]; !ok {
+				previous[imported] = file
+				queue = append(queue, imported)
+			}
+		}
+	}
+	return nil
+}
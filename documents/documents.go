@@ -1,161 +1,721 @@
 package documents
 
 import (
+	"context"
 	"fmt"
 	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime/debug"
+	"slices"
+	"strings"
 	"sync"
-	"sync/atomic"
 
+	"github.com/DDP-Projekt/DDPLS/log"
 	"github.com/DDP-Projekt/DDPLS/uri"
 	"github.com/DDP-Projekt/Kompilierer/src/ast"
 	"github.com/DDP-Projekt/Kompilierer/src/ddperror"
 	"github.com/DDP-Projekt/Kompilierer/src/parser"
+	protocol "github.com/tliron/glsp/protocol_3_16"
 )
 
-var preparsed_duden map[string]*ast.Module
-
-func init() {
-	// preparsed_duden = make(map[string]*ast.Module)
-	// filepath.WalkDir(ddppath.Duden, func(path string, d fs.DirEntry, err error) error {
-	// 	if d == nil || d.IsDir() {
-	// 		return nil
-	// 	}
-	// 	if filepath.Ext(path) != ".ddp" {
-	// 		return nil
-	// 	}
-	// 	mod, err := parser.Parse(parser.Options{
-	// 		FileName: path,
-	// 		Modules:  preparsed_duden,
-	// 	})
-	// 	if err != nil {
-	// 		return err
-	// 	}
-	// 	preparsed_duden[mod.FileName] = mod
-	// 	return nil
-	// })
-}
-
-// represents the state of a single document
+// an immutable snapshot of a document at one version
+// every change publishes a new snapshot, so readers always work on
+// a content, module and errors that belong together
+// snapshots must not be modified after they were published
 type DocumentState struct {
 	Content      string           // the content of the document
+	Lines        *LineIndex       // the line index of Content
 	Uri          uri.URI          // the uri from the client
 	Path         string           // the filepath as parsed from the uri
+	Version      int32            // the version of the document from the client
 	Module       *ast.Module      // the corresponding ddp module
-	NeedReparse  atomic.Bool      // whether the document needs to be reparsed
-	LatestErrors []ddperror.Error // the errors from the last parsing
+	LatestErrors []ddperror.Error // the errors from parsing the content
+	// the instantiations of the generic functions in Module and its imports
+	Instantiations Instantiations
 }
 
-func (d *DocumentState) newErrorCollector() ddperror.Handler {
-	d.LatestErrors = make([]ddperror.Error, 0, 10)
-	return func(err ddperror.Error) {
-		d.LatestErrors = append(d.LatestErrors, err)
+// an open document
+// content and version change with every edit,
+// the snapshot only when the document is reparsed
+type document struct {
+	uri  uri.URI
+	path string
+
+	mu          sync.Mutex         // guards the fields below
+	content     *lineIndex[[]byte] // the latest content, which might not be parsed yet
+	version     int32              // the version of content
+	needReparse bool               // wether content or an import changed since the snapshot was created
+	snapshot    *DocumentState     // the latest parsed snapshot
+	inflight    *parseCall         // the running parse of the document or nil
+	// cancelled when content changes or the document is closed,
+	// so that requests for the old content can stop early
+	changed       context.Context
+	cancelChanged context.CancelFunc
+}
+
+// replaces doc.changed and cancels the old context
+// doc.mu must be held
+func (doc *document) renewContext() {
+	if doc.cancelChanged != nil {
+		doc.cancelChanged()
 	}
+	doc.changed, doc.cancelChanged = context.WithCancel(context.Background())
 }
 
-var n = 0
+// a running parse
+// every caller that needs the new snapshot waits for the same parse
+type parseCall struct {
+	done     chan struct{} // closed when the parse finished
+	snapshot *DocumentState
+	err      error
+}
 
-func (d *DocumentState) reParseInContext(modules map[string]*ast.Module, errorHandler ddperror.Handler) (err error) {
-	if duden_mod, ok := preparsed_duden[d.Path]; ok {
-		d.Module = duden_mod
-	} else {
-		// clear generic instantiations to not leak memory
-		ast.VisitModule(d.Module, &genericsClearer{mod: d.Module})
+// marks a new parse of doc as running and returns it
+// doc.mu must be held
+func (doc *document) startParse() *parseCall {
+	doc.inflight = &parseCall{done: make(chan struct{})}
+	return doc.inflight
+}
+
+// runs parse and hands its result to everyone waiting for call
+func (doc *document) finishParse(call *parseCall, parse func(*document) (*DocumentState, error)) {
+	defer func() {
+		// parses might run in their own goroutine, where a panic would crash the server
+		if err := recover(); err != nil {
+			log.Errorf("panic of type %s while parsing %s: %v", reflect.TypeOf(err), doc.path, err)
+			log.Errorf("stack trace: %s", string(debug.Stack()))
+			call.snapshot, call.err = nil, fmt.Errorf("panic while parsing %s: %v", doc.path, err)
+		}
+
+		doc.mu.Lock()
+		doc.inflight = nil
+		doc.mu.Unlock()
+		close(call.done)
+	}()
+	call.snapshot, call.err = parse(doc)
+}
 
-		duden := make(map[string]*ast.Module, len(preparsed_duden))
-		maps.Copy(duden, preparsed_duden)
-		d.Module, err = parser.Parse(parser.Options{
-			FileName: d.Path,
-			Source:   []byte(d.Content),
-			// TODO: make this work better
-			// Modules:      merge_map_into(preparsed_duden, modules),
-			Modules:      duden,
-			ErrorHandler: errorHandler,
-		})
+// reports wether content differs from the file at path
+func isModified(path, content string) bool {
+	onDisk, err := os.ReadFile(path)
+	return err != nil || string(onDisk) != content
+}
+
+// parses the current content of doc into a new snapshot
+// modules are the modules of the other open documents and the cached Duden modules,
+// which are imported instead of the files on disk
+// returns the modules the parser imported from disk in addition to the snapshot
+// the paths of modules and the imports of the previous snapshot must be locked
+func (doc *document) parse(modules map[string]*ast.Module) (*DocumentState, map[string]*ast.Module, error) {
+	doc.mu.Lock()
+	content := string(doc.content.text)
+	snapshot := &DocumentState{
+		Content:      content,
+		Lines:        &LineIndex{text: content, starts: slices.Clone(doc.content.starts)},
+		Uri:          doc.uri,
+		Path:         doc.path,
+		Version:      doc.version,
+		LatestErrors: make([]ddperror.Error, 0, 10),
 	}
+	previous := doc.snapshot
+	doc.mu.Unlock()
 
-	d.NeedReparse.Store(false)
+	if duden_mod, ok := duden.get(doc.path); ok && !isModified(doc.path, snapshot.Content) {
+		snapshot.Module = duden_mod
+		return snapshot, nil, nil
+	}
 
-	return err
+	if previous != nil {
+		// clear generic instantiations to not leak memory
+		// the Duden modules are shared, so they would keep the old instantiations
+		ast.VisitModule(previous.Module, &genericsClearer{mod: previous.Module})
+	}
+
+	imported := maps.Clone(modules)
+	var err error
+	snapshot.Module, err = parser.Parse(parser.Options{
+		FileName: doc.path,
+		Source:   []byte(snapshot.Content),
+		Modules:  imported,
+		ErrorHandler: func(err ddperror.Error) {
+			snapshot.LatestErrors = append(snapshot.LatestErrors, err)
+		},
+	})
+
+	for path := range modules {
+		delete(imported, path)
+	}
+	return snapshot, imported, err
 }
 
 // a synced map that manages document states
 type DocumentManager struct {
-	mu             sync.Mutex
-	documentStates map[uri.URI]*DocumentState
+	mu           sync.Mutex // guards documents and dependencies
+	documents    map[uri.URI]*document
+	dependencies *dependencyGraph
+	// a parse locks the document and every shared module it might import,
+	// as the parser modifies the imported modules
+	parseLocks *pathLocks
+	index      *workspaceIndex
+	// the encoding of the positions the client sends and expects
+	// guarded by mu
+	encoding PositionEncoding
 }
 
 func NewDocumentManager() *DocumentManager {
 	return &DocumentManager{
-		mu:             sync.Mutex{},
-		documentStates: make(map[uri.URI]*DocumentState),
+		documents:    make(map[uri.URI]*document),
+		dependencies: newDependencyGraph(),
+		parseLocks:   newPathLocks(),
+		index:        newWorkspaceIndex(),
+		encoding:     PositionEncodingUTF16,
 	}
 }
 
+// sets the position encoding negotiated with the client
+func (dm *DocumentManager) SetPositionEncoding(enc PositionEncoding) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	dm.encoding = enc
+}
+
+// returns the position encoding negotiated with the client
+func (dm *DocumentManager) PositionEncoding() PositionEncoding {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	return dm.encoding
+}
+
+// sets the workspace folders whose .ddp files are indexed
+func (dm *DocumentManager) SetWorkspaceFolders(folders []string) {
+	dm.index.setFolders(folders)
+}
+
+// reports wether the file at path belongs to the workspace
+// files in the Duden never do
+func (dm *DocumentManager) InWorkspace(path string) bool {
+	return dm.index.contains(path)
+}
+
+// indexes all .ddp files in the workspace folders and the Duden
+// that are new or changed since the last call
+// files with a cached summary are only parsed when their module is needed
+// progress is called after every parsed file and may be nil
+func (dm *DocumentManager) IndexWorkspace(progress func(done, total int)) {
+	dm.index.refresh(progress)
+}
+
+// (re-)indexes the files at paths, which were created, changed or deleted
+// like IndexWorkspace, but without walking the workspace folders
+// changed Duden files are also parsed again by the next document that imports them
+func (dm *DocumentManager) IndexFiles(paths []string) {
+	duden.invalidate(paths)
+	dm.index.update(paths)
+}
+
+// returns the modules of the indexed .ddp files that might reference declarations of the file at path,
+// which are the file itself and the modules that import it or reference its declarations
+// if path is empty, the modules of all indexed files are returned
+// files that were loaded from the cache are parsed first
+// the content of open documents is not taken into account
+func (dm *DocumentManager) IndexedModulesReferencing(path string) []*ast.Module {
+	return dm.index.snapshot(path)
+}
+
+// returns the instantiations of the generic functions in the indexed modules
+// the result must not be modified
+func (dm *DocumentManager) IndexedInstantiations() Instantiations {
+	return dm.index.indexedInstantiations()
+}
+
+// returns the summaries of all indexed files
+func (dm *DocumentManager) IndexedSummaries() []*ModuleSummary {
+	return dm.index.allSummaries()
+}
+
+// returns the summary of the indexed file at path
+func (dm *DocumentManager) IndexedSummary(path string) (*ModuleSummary, bool) {
+	return dm.index.summary(path)
+}
+
 // adds a document to the map
 // and parses its content
-func (dm *DocumentManager) AddAndParse(vscURI, content string) error {
+func (dm *DocumentManager) AddAndParse(vscURI string, version int32, content string) error {
 	docURI := uri.FromURI(vscURI)
-	docState := &DocumentState{
-		Uri:     docURI,
-		Content: content,
-		Path:    docURI.Filepath(),
+	doc := &document{
+		uri:         docURI,
+		path:        docURI.Filepath(),
+		content:     newLineIndex([]byte(content)),
+		version:     version,
+		needReparse: true,
 	}
+	doc.renewContext()
 	dm.mu.Lock()
-	defer dm.mu.Unlock()
-	dm.documentStates[docURI] = docState
+	dm.documents[docURI] = doc
+	dm.mu.Unlock()
+
+	// the dependents now import the document instead of the file on disk
+	defer dm.markDependentsDirty(doc.path)
+	_, err := dm.latest(context.Background(), doc)
+	return err
+}
 
-	return dm.reParse(docURI, docState.newErrorCollector())
+// a change to the content of a document
+// a nil Range replaces the whole content
+type ContentChange struct {
+	Range *protocol.Range
+	Text  string
 }
 
-func (dm *DocumentManager) reParse(docUri uri.URI, errHndl ddperror.Handler) error {
-	doc, ok := dm.documentStates[docUri]
+// applies changes to the content of a document in order
+// the document and the open documents that import it are reparsed on their next use
+func (dm *DocumentManager) ApplyChanges(vscURI string, version int32, changes []ContentChange) error {
+	doc, ok := dm.document(uri.FromURI(vscURI))
 	if !ok {
-		return fmt.Errorf("document %s not found in map", docUri)
+		return fmt.Errorf("%s not in document map", vscURI)
 	}
 
-	modules := map[string]*ast.Module{}
-	for _, v := range dm.documentStates {
-		if v != doc && v.Module != nil {
-			modules[v.Module.FileName] = v.Module
+	enc := dm.PositionEncoding()
+	doc.mu.Lock()
+	for _, change := range changes {
+		if change.Range == nil {
+			doc.content = newLineIndex([]byte(change.Text))
+			continue
 		}
+		start, end := doc.content.ProtocolOffset(change.Range.Start, enc), doc.content.ProtocolOffset(change.Range.End, enc)
+		replaceText(doc.content, start, end, change.Text)
 	}
+	doc.version = version
+	doc.needReparse = true
+	doc.renewContext()
+	doc.mu.Unlock()
 
-	return doc.reParseInContext(modules, errHndl)
+	dm.markDependentsDirty(doc.path)
+	return nil
 }
 
-func (dm *DocumentManager) Get(vscURI string) (*DocumentState, bool) {
+func (dm *DocumentManager) document(docUri uri.URI) (*document, bool) {
 	dm.mu.Lock()
 	defer dm.mu.Unlock()
-	doc, ok := dm.documentStates[uri.FromURI(vscURI)]
-	if !ok {
-		return nil, ok
+	doc, ok := dm.documents[docUri]
+	return doc, ok
+}
+
+// returns all open documents
+func (dm *DocumentManager) openDocuments() []*document {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	docs := make([]*document, 0, len(dm.documents))
+	for _, doc := range dm.documents {
+		docs = append(docs, doc)
 	}
+	return docs
+}
 
-	if doc.NeedReparse.Load() {
-		ok = dm.reParse(doc.Uri, doc.newErrorCollector()) == nil
+// parses doc and publishes the new snapshot
+// only the open documents that doc imports are parsed before, if they changed
+// doc.inflight must be set
+func (dm *DocumentManager) reParse(doc *document) (*DocumentState, error) {
+	doc.mu.Lock()
+	if !doc.needReparse && doc.snapshot != nil {
+		// another document that imports doc parsed it in the meantime
+		snapshot := doc.snapshot
+		doc.mu.Unlock()
+		return snapshot, nil
 	}
-	return doc, ok
+	doc.needReparse = false
+	previous := doc.snapshot
+	doc.mu.Unlock()
+
+	paths := dm.predictImports(doc, previous)
+	var (
+		snapshot *DocumentState
+		openDocs map[string]*DocumentState
+	)
+	for snapshot == nil {
+		var modules map[string]*ast.Module
+		modules, openDocs = dm.updateImports(doc, paths)
+
+		unlock := dm.parseLocks.lock(paths)
+		parsed, fromDisk, err := doc.parse(modules)
+		if err != nil {
+			unlock()
+			return nil, err
+		}
+
+		// an open document or cached Duden module that was not locked
+		// must not be used, so the parse is repeated with them locked
+		if missing := dm.unlockedImports(parsed.Module, paths); len(missing) > 0 {
+			// the module of a Duden document might be the cached one, whose instantiations are still used
+			if cached, ok := duden.get(doc.path); !ok || cached != parsed.Module {
+				ast.VisitModule(parsed.Module, &genericsClearer{mod: parsed.Module})
+			}
+			unlock()
+			maps.Copy(paths, missing)
+			continue
+		}
+
+		parsed.Instantiations = collectInstantiations(parsed.Module)
+		// Duden modules that were imported for the first time
+		// they are shared as soon as they are cached, so the parse must not modify them afterwards
+		duden.add(fromDisk)
+		unlock()
+		snapshot = parsed
+	}
+
+	errHndl := func(err ddperror.Error) {
+		snapshot.LatestErrors = append(snapshot.LatestErrors, err)
+	}
+
+	// the open documents were parsed before, so their errors have to be reported again
+	visitImports(snapshot.Module, func(mod *ast.Module) {
+		if v, isOpen := openDocs[mod.FileName]; isOpen && v.Module == mod {
+			for _, err := range v.LatestErrors {
+				if !containsError(snapshot.LatestErrors, err) {
+					errHndl(err)
+				}
+			}
+		}
+	})
+
+	// a new import might close a cycle with the documents that import this one
+	dm.mu.Lock()
+	importsChanged := dm.dependencies.update(snapshot.Module, openDocs)
+	dm.reportImportCycles(snapshot, errHndl)
+	dm.mu.Unlock()
+	if importsChanged {
+		dm.markDependentsDirty(doc.path)
+	}
+
+	doc.mu.Lock()
+	// the document might have been parsed again while the imports were parsed
+	if doc.snapshot == nil || doc.snapshot.Version <= snapshot.Version {
+		doc.snapshot = snapshot
+	}
+	doc.mu.Unlock()
+	return snapshot, nil
 }
 
-func (dm *DocumentManager) GetFromMod(mod *ast.Module) (*DocumentState, bool) {
+// returns the paths that a parse of doc has to lock
+// these are doc, the files it imported the last time it was parsed and
+// the files the dependency graph knows it to import
+func (dm *DocumentManager) predictImports(doc *document, previous *DocumentState) map[string]struct{} {
+	paths := map[string]struct{}{doc.path: {}}
+	if previous != nil && previous.Module != nil {
+		maps.Copy(paths, importedPaths(previous.Module))
+	} else {
+		// a document that was never parsed might import any Duden module
+		maps.Copy(paths, duden.paths())
+	}
+
 	dm.mu.Lock()
 	defer dm.mu.Unlock()
-	for _, doc := range dm.documentStates {
-		if doc.Module == mod {
-			ok := true
-			if doc.NeedReparse.Load() {
-				ok = dm.reParse(doc.Uri, doc.newErrorCollector()) == nil
+	maps.Copy(paths, dm.dependencies.imported(doc.path))
+	return paths
+}
+
+// brings the outdated open documents in paths up to date and adds their imports
+// and the imports of the cached Duden modules in paths to paths
+// returns the modules to import by their filepath and the snapshots of the open documents among them
+func (dm *DocumentManager) updateImports(doc *document, paths map[string]struct{}) (map[string]*ast.Module, map[string]*DocumentState) {
+	openDocs := map[string]*DocumentState{}
+	for grown := true; grown; {
+		grown = false
+		addImports := func(mod *ast.Module) {
+			for path := range importedPaths(mod) {
+				if _, ok := paths[path]; !ok {
+					paths[path] = struct{}{}
+					grown = true
+				}
 			}
-			return doc, ok
+		}
+
+		for _, v := range dm.openDocuments() {
+			if _, ok := paths[v.path]; !ok || v == doc {
+				continue
+			}
+			if _, ok := openDocs[v.path]; ok {
+				continue
+			}
+
+			// v is imported, so it has to be up to date
+			// documents that are already being parsed are used as they are,
+			// as their parse might import doc
+			v.mu.Lock()
+			var call *parseCall
+			if (v.needReparse || v.snapshot == nil) && v.inflight == nil {
+				call = v.startParse()
+			}
+			v.mu.Unlock()
+			if call != nil {
+				v.finishParse(call, dm.reParse)
+			}
+
+			v.mu.Lock()
+			snapshot := v.snapshot
+			v.mu.Unlock()
+			if snapshot != nil && snapshot.Module != nil {
+				openDocs[snapshot.Module.FileName] = snapshot
+				addImports(snapshot.Module)
+			}
+		}
+
+		for _, mod := range duden.snapshot(paths) {
+			addImports(mod)
+		}
+	}
+
+	// the open documents are imported instead of their files on disk
+	modules := make(map[string]*ast.Module, len(openDocs))
+	for path, snapshot := range openDocs {
+		modules[path] = snapshot.Module
+	}
+	return merge_map_into(modules, duden.snapshot(paths)), openDocs
+}
+
+// returns the paths of the open documents and cached Duden modules
+// that mod imports but that are not in locked
+func (dm *DocumentManager) unlockedImports(mod *ast.Module, locked map[string]struct{}) map[string]struct{} {
+	unlocked := map[string]*ast.Module{}
+	check := func(mod *ast.Module) {
+		if _, ok := locked[mod.FileName]; !ok {
+			unlocked[mod.FileName] = mod
+		}
+	}
+	check(mod)
+	visitImports(mod, check)
+	if len(unlocked) == 0 {
+		return nil
+	}
+
+	paths := make(map[string]struct{}, len(unlocked))
+	for path := range unlocked {
+		paths[path] = struct{}{}
+	}
+
+	missing := map[string]struct{}{}
+	cached := duden.snapshot(paths)
+	for path, mod := range unlocked {
+		if cached[path] == mod {
+			missing[path] = struct{}{}
+		}
+	}
+	for _, doc := range dm.openDocuments() {
+		if _, ok := unlocked[doc.path]; ok {
+			missing[doc.path] = struct{}{}
+		}
+	}
+	return missing
+}
+
+// reports every import of doc that leads back to doc
+// the parser cannot detect these cycles, as the open documents are parsed on their own
+func (dm *DocumentManager) reportImportCycles(doc *DocumentState, errHndl ddperror.Handler) {
+	for _, imprt := range doc.Module.Imports {
+		for _, imported := range imprt.Modules {
+			cycle := dm.dependencies.findPath(imported.FileName, doc.Module.FileName)
+			if cycle == nil {
+				continue
+			}
+
+			names := []string{filepath.Base(doc.Module.FileName)}
+			for _, file := range cycle {
+				names = append(names, filepath.Base(file))
+			}
+			err := ddperror.New(ddperror.MISC_INCLUDE_ERROR, ddperror.LEVEL_ERROR, imprt.Range,
+				fmt.Sprintf("Zwei Module dürfen sich nicht gegenseitig einbinden! (%s)", strings.Join(names, " -> ")),
+				doc.Module.FileName,
+			)
+
+			// the parser might have found the cycle already
+			if !containsError(doc.LatestErrors, err) {
+				errHndl(err)
+			}
+			break
+		}
+	}
+}
+
+// calls fn for every module that is imported by mod directly or indirectly
+func visitImports(mod *ast.Module, fn func(*ast.Module)) {
+	visited := map[*ast.Module]struct{}{mod: {}}
+	var visit func(mod *ast.Module)
+	visit = func(mod *ast.Module) {
+		for _, imprt := range mod.Imports {
+			for _, imported := range imprt.Modules {
+				if _, ok := visited[imported]; ok {
+					continue
+				}
+				visited[imported] = struct{}{}
+				fn(imported)
+				visit(imported)
+			}
+		}
+	}
+	visit(mod)
+}
+
+// reports wether errs contains an error with the same code at the same location
+func containsError(errs []ddperror.Error, err ddperror.Error) bool {
+	return slices.ContainsFunc(errs, func(other ddperror.Error) bool {
+		return other.Code == err.Code && other.Range == err.Range && other.File == err.File
+	})
+}
+
+// marks all open documents that import path directly or indirectly as changed
+func (dm *DocumentManager) markDependentsDirty(path string) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	dependents := dm.dependencies.dependents(path)
+	for _, doc := range dm.documents {
+		if _, ok := dependents[doc.path]; ok {
+			doc.mu.Lock()
+			doc.needReparse = true
+			doc.mu.Unlock()
+		}
+	}
+}
+
+// returns the uris of all open documents that import the given document directly or indirectly
+func (dm *DocumentManager) Dependents(vscURI string) []uri.URI {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	dependents := dm.dependencies.dependents(uri.FromURI(vscURI).Filepath())
+	result := make([]uri.URI, 0, len(dependents))
+	for _, doc := range dm.documents {
+		if _, ok := dependents[doc.path]; ok {
+			result = append(result, doc.uri)
+		}
+	}
+	return result
+}
+
+// returns the latest snapshot of doc
+// if doc changed, it is reparsed first
+// concurrent calls for the same document share a single parse
+// if ctx is done before the parse finished, ctx.Err() is returned
+// and the parse continues in the background
+func (dm *DocumentManager) latest(ctx context.Context, doc *document) (*DocumentState, error) {
+	doc.mu.Lock()
+	if !doc.needReparse && doc.snapshot != nil {
+		snapshot := doc.snapshot
+		doc.mu.Unlock()
+		return snapshot, nil
+	}
+
+	call := doc.inflight
+	if call == nil {
+		call = doc.startParse()
+		go doc.finishParse(call, dm.reParse)
+	}
+	doc.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.snapshot, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// reports wether the document is open
+func (dm *DocumentManager) IsOpen(vscURI string) bool {
+	_, ok := dm.document(uri.FromURI(vscURI))
+	return ok
+}
+
+// returns the latest snapshot of a document
+func (dm *DocumentManager) Get(vscURI string) (*DocumentState, bool) {
+	snapshot, err := dm.GetWithContext(context.Background(), vscURI)
+	return snapshot, err == nil
+}
+
+// like Get, but stops waiting for the document to be parsed once ctx is done
+func (dm *DocumentManager) GetWithContext(ctx context.Context, vscURI string) (*DocumentState, error) {
+	doc, ok := dm.document(uri.FromURI(vscURI))
+	if !ok {
+		return nil, fmt.Errorf("%s not in document map", vscURI)
+	}
+	return dm.latest(ctx, doc)
+}
+
+// returns a context that is cancelled when the content of the document changes
+// or the document is closed
+// requests use it to stop working on an outdated version of the document
+func (dm *DocumentManager) Context(vscURI string) context.Context {
+	doc, ok := dm.document(uri.FromURI(vscURI))
+	if !ok {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		return ctx
+	}
+	doc.mu.Lock()
+	defer doc.mu.Unlock()
+	return doc.changed
+}
+
+// returns the latest snapshot of the document whose module is mod
+func (dm *DocumentManager) GetFromMod(mod *ast.Module) (*DocumentState, bool) {
+	for _, doc := range dm.openDocuments() {
+		doc.mu.Lock()
+		isMod := doc.snapshot != nil && doc.snapshot.Module == mod
+		doc.mu.Unlock()
+		if isMod {
+			snapshot, err := dm.latest(context.Background(), doc)
+			return snapshot, err == nil
 		}
 	}
 	return nil, false
 }
 
+// returns the latest snapshots of all documents in the map
+// reparsing them if necessary
+func (dm *DocumentManager) GetAll() []*DocumentState {
+	docs := dm.openDocuments()
+	snapshots := make([]*DocumentState, 0, len(docs))
+	for _, doc := range docs {
+		if snapshot, err := dm.latest(context.Background(), doc); err == nil {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	return snapshots
+}
+
+// reports wether snapshot belongs to the latest version of its document
+// results computed from an outdated snapshot should be dropped
+func (dm *DocumentManager) IsLatest(snapshot *DocumentState) bool {
+	doc, ok := dm.document(snapshot.Uri)
+	if !ok {
+		return false
+	}
+	doc.mu.Lock()
+	defer doc.mu.Unlock()
+	return doc.version == snapshot.Version && !doc.needReparse
+}
+
 func (dm *DocumentManager) Delete(vscURI string) {
+	docUri := uri.FromURI(vscURI)
 	dm.mu.Lock()
-	defer dm.mu.Unlock()
-	delete(dm.documentStates, uri.FromURI(vscURI))
+	doc, ok := dm.documents[docUri]
+	delete(dm.documents, docUri)
+	dm.mu.Unlock()
+
+	if ok {
+		doc.mu.Lock()
+		snapshot := doc.snapshot
+		doc.cancelChanged()
+		doc.mu.Unlock()
+		if snapshot != nil {
+			// the shared Duden modules would keep the instantiations of the closed document
+			unlock := dm.parseLocks.lock(importedPaths(snapshot.Module))
+			ast.VisitModule(snapshot.Module, &genericsClearer{mod: snapshot.Module})
+			unlock()
+		}
+	}
+	// the dependents now import the file on disk again
+	dm.markDependentsDirty(docUri.Filepath())
 }
 
 // merges a into b and returns b
@@ -0,0 +1,203 @@
+package documents
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DDP-Projekt/DDPLS/uri"
+)
+
+const genericDecl = `Die öffentliche generische Funktion foo mit dem Parameter a vom Typ T, gibt ein T zurück, macht:
+	Gib a zurück.
+Und kann so benutzt werden:
+	"foo <a>"
+`
+
+// documents that instantiate the generic function of an open document
+// are changed, read and closed concurrently
+// run with -race to detect unsynchronized access to the shared modules
+func TestConcurrentAccess(t *testing.T) {
+	dir := t.TempDir()
+	declPath := filepath.Join(dir, "decl.ddp")
+	if err := os.WriteFile(declPath, []byte(genericDecl), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	declUri := string(uri.FromPath(declPath))
+
+	dm := NewDocumentManager()
+	if err := dm.AddAndParse(declUri, 1, genericDecl); err != nil {
+		t.Fatal(err)
+	}
+
+	source := func(i int) string {
+		return fmt.Sprintf("Binde \"decl\" ein.\nDie Zahl z ist foo %d.\nDie Kommazahl k ist foo %d,5.\n", i, i)
+	}
+
+	docUris := make([]string, 3)
+	for i := range docUris {
+		docUris[i] = string(uri.FromPath(filepath.Join(dir, fmt.Sprintf("doc%d.ddp", i))))
+		if err := dm.AddAndParse(docUris[i], 1, source(0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	const iterations = 20
+	wg := sync.WaitGroup{}
+	for _, docUri := range docUris[:2] {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := range iterations {
+				if err := dm.ApplyChanges(docUri, int32(i+2), []ContentChange{{Text: source(i)}}); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for range iterations {
+				doc, ok := dm.Get(docUri)
+				if !ok {
+					t.Errorf("%s not found", docUri)
+					return
+				}
+				for decl, instantiations := range doc.Instantiations {
+					for _, instantiation := range instantiations {
+						if instantiation.GenericInstantiation.GenericDecl != decl || instantiation.Body == nil {
+							t.Errorf("invalid instantiation of %s", decl.Name())
+						}
+					}
+				}
+			}
+		}()
+	}
+
+	// the last document is closed and opened again
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := range iterations {
+			dm.Delete(docUris[2])
+			if err := dm.AddAndParse(docUris[2], int32(i+2), source(i)); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+
+	// the generic function itself changes
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := range iterations {
+			if err := dm.ApplyChanges(declUri, int32(i+2), []ContentChange{{Text: genericDecl}}); err != nil {
+				t.Error(err)
+			}
+			dm.GetAll()
+		}
+	}()
+	wg.Wait()
+
+	for _, docUri := range docUris {
+		doc, ok := dm.Get(docUri)
+		if !ok {
+			t.Fatalf("%s not found", docUri)
+		}
+		if len(doc.LatestErrors) != 0 {
+			t.Errorf("%s: unexpected errors %v", docUri, doc.LatestErrors)
+		}
+
+		instantiations := 0
+		for _, insts := range doc.Instantiations {
+			instantiations += len(insts)
+		}
+		if instantiations == 0 {
+			t.Errorf("%s: no instantiations", docUri)
+		}
+	}
+}
+
+// parsing a document only parses the changed open documents it imports
+func TestReParseOnlyImports(t *testing.T) {
+	dir := t.TempDir()
+	declPath := filepath.Join(dir, "decl.ddp")
+	if err := os.WriteFile(declPath, []byte(genericDecl), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	declUri := string(uri.FromPath(declPath))
+	mainUri := string(uri.FromPath(filepath.Join(dir, "main.ddp")))
+	otherUri := string(uri.FromPath(filepath.Join(dir, "other.ddp")))
+
+	dm := NewDocumentManager()
+	for docUri, content := range map[string]string{
+		declUri:  genericDecl,
+		mainUri:  "Binde \"decl\" ein.\nDie Zahl z ist foo 1.\n",
+		otherUri: "Die Zahl x ist 1.\n",
+	} {
+		if err := dm.AddAndParse(docUri, 1, content); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for docUri, content := range map[string]string{
+		declUri:  genericDecl + "\n",
+		otherUri: "Die Zahl x ist 2.\n",
+	} {
+		if err := dm.ApplyChanges(docUri, 2, []ContentChange{{Text: content}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := dm.Get(mainUri); !ok {
+		t.Fatalf("%s not found", mainUri)
+	}
+
+	needsReparse := func(docUri string) bool {
+		doc, _ := dm.document(uri.FromURI(docUri))
+		doc.mu.Lock()
+		defer doc.mu.Unlock()
+		return doc.needReparse
+	}
+	if needsReparse(declUri) {
+		t.Errorf("the imported document was not parsed")
+	}
+	if !needsReparse(otherUri) {
+		t.Errorf("the independent document was parsed")
+	}
+}
+
+// locks of disjoint paths do not wait for each other
+func TestPathLocks(t *testing.T) {
+	locks := newPathLocks()
+	unlockA := locks.lock(map[string]struct{}{"a": {}})
+
+	locked := func(paths map[string]struct{}) chan func() {
+		unlock := make(chan func(), 1)
+		go func() { unlock <- locks.lock(paths) }()
+		return unlock
+	}
+
+	select {
+	case unlock := <-locked(map[string]struct{}{"b": {}}):
+		unlock()
+	case <-time.After(time.Second):
+		t.Fatal("locking b waited for a")
+	}
+
+	both := locked(map[string]struct{}{"a": {}, "b": {}})
+	select {
+	case <-both:
+		t.Fatal("a was locked twice")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	unlockA()
+	select {
+	case unlock := <-both:
+		unlock()
+	case <-time.After(time.Second):
+		t.Fatal("unlocking a did not release the waiting lock")
+	}
+}
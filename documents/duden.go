@@ -0,0 +1,162 @@
+package documents
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DDP-Projekt/Kompilierer/src/ast"
+	"github.com/DDP-Projekt/Kompilierer/src/ddppath"
+)
+
+// the Duden modules shared by all documents
+var duden = newDudenCache()
+
+// caches the parsed modules of the Duden
+// every module is parsed once, when it is first imported by a document,
+// and then shared between all documents instead of being reparsed on every change
+// modules are only removed when the file watcher reports their file as changed (see invalidate),
+// so lookups never touch the disk
+type dudenCache struct {
+	mu       sync.Mutex
+	modules  map[string]*ast.Module // parsed modules by their filepath
+	modTimes map[string]time.Time   // modification time of the file when it was parsed
+}
+
+func newDudenCache() *dudenCache {
+	return &dudenCache{
+		modules:  make(map[string]*ast.Module),
+		modTimes: make(map[string]time.Time),
+	}
+}
+
+// reports wether path is a file inside the Duden
+func isDudenPath(path string) bool {
+	return strings.HasPrefix(path, ddppath.Duden+string(filepath.Separator))
+}
+
+// returns the cached module of path
+func (cache *dudenCache) get(path string) (*ast.Module, bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	mod, ok := cache.modules[path]
+	return mod, ok
+}
+
+// returns a copy of the cached modules at paths
+// the copy is meant to be passed to parser.Options.Modules,
+// which adds every newly imported module to it
+func (cache *dudenCache) snapshot(paths map[string]struct{}) map[string]*ast.Module {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	modules := make(map[string]*ast.Module, len(paths))
+	for path := range paths {
+		if mod, ok := cache.modules[path]; ok {
+			modules[path] = mod
+		}
+	}
+	return modules
+}
+
+// returns the paths of all cached modules
+func (cache *dudenCache) paths() map[string]struct{} {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	paths := make(map[string]struct{}, len(cache.modules))
+	for path := range cache.modules {
+		paths[path] = struct{}{}
+	}
+	return paths
+}
+
+// adds the Duden modules from a map that was passed to parser.Options.Modules
+// modules that are already cached or that import something outside of the Duden are skipped
+func (cache *dudenCache) add(modules map[string]*ast.Module) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	for path, mod := range modules {
+		if mod == nil || !isDudenPath(path) {
+			continue
+		}
+		if _, ok := cache.modules[path]; ok || !importsOnlyDuden(mod, make(map[*ast.Module]struct{})) {
+			continue
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		cache.modules[path] = mod
+		cache.modTimes[path] = info.ModTime()
+	}
+}
+
+// reports wether mod and all its imports are part of the Duden
+// only those modules can be shared between documents
+func importsOnlyDuden(mod *ast.Module, visited map[*ast.Module]struct{}) bool {
+	if _, ok := visited[mod]; ok {
+		return true
+	}
+	visited[mod] = struct{}{}
+
+	if !isDudenPath(mod.FileName) {
+		return false
+	}
+	for _, imprt := range mod.Imports {
+		for _, imported := range imprt.Modules {
+			if !importsOnlyDuden(imported, visited) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// removes the modules of the files at paths that changed on disk
+// and all modules that import one of them, as they reference the old module
+// paths are the files reported by the file watcher, most of them are not cached
+func (cache *dudenCache) invalidate(paths []string) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	for _, path := range paths {
+		if _, ok := cache.modules[path]; !ok {
+			continue
+		}
+		if info, err := os.Stat(path); err != nil || !info.ModTime().Equal(cache.modTimes[path]) {
+			cache.remove(path)
+		}
+	}
+
+	for removed := true; removed; {
+		removed = false
+		for path, mod := range cache.modules {
+			if !cache.importsAreCached(mod) {
+				cache.remove(path)
+				removed = true
+			}
+		}
+	}
+}
+
+// reports wether every module imported by mod is the one in the cache
+func (cache *dudenCache) importsAreCached(mod *ast.Module) bool {
+	for _, imprt := range mod.Imports {
+		for _, imported := range imprt.Modules {
+			if cache.modules[imported.FileName] != imported {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (cache *dudenCache) remove(path string) {
+	delete(cache.modules, path)
+	delete(cache.modTimes, path)
+}
@@ -0,0 +1,46 @@
+package documents
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DDP-Projekt/Kompilierer/src/ast"
+)
+
+// lookups do not check the files on disk,
+// only the files reported by the file watcher are removed together with their importers
+func TestDudenCacheInvalidate(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	cache := newDudenCache()
+	for _, name := range []string{"a.ddp", "b.ddp", "c.ddp", "touched.ddp"} {
+		if err := os.WriteFile(path(name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(path(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cache.modules[path(name)] = &ast.Module{FileName: path(name)}
+		cache.modTimes[path(name)] = info.ModTime()
+	}
+	// b imports a
+	cache.modules[path("b.ddp")].Imports = []*ast.ImportStmt{{Modules: []*ast.Module{cache.modules[path("a.ddp")]}}}
+
+	modTime := time.Now().Add(time.Second)
+	if err := os.Chtimes(path("a.ddp"), modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cache.get(path("a.ddp")); !ok {
+		t.Error("a.ddp was removed before the file watcher reported it")
+	}
+
+	cache.invalidate([]string{path("a.ddp"), path("touched.ddp"), path("other.ddp")})
+	for name, want := range map[string]bool{"a.ddp": false, "b.ddp": false, "c.ddp": true, "touched.ddp": true} {
+		if _, ok := cache.get(path(name)); ok != want {
+			t.Errorf("%s is cached: %v, want %v", name, ok, want)
+		}
+	}
+}
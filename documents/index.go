@@ -0,0 +1,474 @@
+package documents
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/DDP-Projekt/DDPLS/log"
+	"github.com/DDP-Projekt/Kompilierer/src/ast"
+	"github.com/DDP-Projekt/Kompilierer/src/ddperror"
+	"github.com/DDP-Projekt/Kompilierer/src/ddppath"
+	"github.com/DDP-Projekt/Kompilierer/src/parser"
+)
+
+// keeps the summaries of all .ddp files in the workspace folders and the Duden
+// and their parsed modules, so that features also work for files that are not open
+// files whose summary was loaded from the cache are only parsed when a module is needed
+type workspaceIndex struct {
+	mu        sync.Mutex
+	refreshMu sync.Mutex // only one refresh or update runs at a time
+	folders   []string
+	modules   map[string]*ast.Module // parsed modules by their filepath
+	modTimes  map[string]time.Time   // modification time of the file when it was indexed
+	summaries map[string]*ModuleSummary
+	// the cache files of the summaries by the filepath they belong to
+	cacheFiles map[string]string
+	// the instantiations of the generic functions in modules
+	instantiations Instantiations
+	// the files being parsed by a load, with a channel that is closed when the load finished
+	loading map[string]chan struct{}
+}
+
+func newWorkspaceIndex() *workspaceIndex {
+	return &workspaceIndex{
+		modules:        make(map[string]*ast.Module),
+		modTimes:       make(map[string]time.Time),
+		summaries:      make(map[string]*ModuleSummary),
+		cacheFiles:     make(map[string]string),
+		instantiations: make(Instantiations),
+		loading:        make(map[string]chan struct{}),
+	}
+}
+
+func (index *workspaceIndex) setFolders(folders []string) {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+	index.folders = folders
+}
+
+// reports wether path is inside one of the folders
+// if there are no folders, every path that is not in the Duden counts as inside
+func (index *workspaceIndex) contains(path string) bool {
+	if isDudenPath(path) {
+		return false
+	}
+
+	index.mu.Lock()
+	defer index.mu.Unlock()
+	if len(index.folders) == 0 {
+		return true
+	}
+	for _, folder := range index.folders {
+		if rel, err := filepath.Rel(folder, path); err == nil && filepath.IsLocal(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the modules of the indexed files that might reference declarations of the file at path,
+// which are the file itself and the files that import it or reference one of its declarations
+// if path is empty, the modules of all indexed files are returned
+// files that were only loaded from the cache are parsed first
+// the modules are sorted by their filepath
+func (index *workspaceIndex) snapshot(path string) []*ast.Module {
+	index.mu.Lock()
+	pending := make([]string, 0)
+	for file, summary := range index.summaries {
+		if _, ok := index.modules[file]; !ok && (path == "" || summary.references(path)) {
+			pending = append(pending, file)
+		}
+	}
+	index.mu.Unlock()
+
+	if len(pending) > 0 {
+		index.load(pending)
+	}
+
+	index.mu.Lock()
+	defer index.mu.Unlock()
+	modules := make([]*ast.Module, 0, len(index.modules))
+	for file, mod := range index.modules {
+		if summary, ok := index.summaries[file]; path == "" || ok && summary.references(path) {
+			modules = append(modules, mod)
+		}
+	}
+	sort.Slice(modules, func(i, j int) bool {
+		return modules[i].FileName < modules[j].FileName
+	})
+	return modules
+}
+
+// returns the instantiations of the generic functions in the indexed modules
+// the result must not be modified
+func (index *workspaceIndex) indexedInstantiations() Instantiations {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+	return index.instantiations
+}
+
+// returns the summaries of all indexed files sorted by their filepath
+func (index *workspaceIndex) allSummaries() []*ModuleSummary {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+
+	summaries := make([]*ModuleSummary, 0, len(index.summaries))
+	for _, summary := range index.summaries {
+		summaries = append(summaries, summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].FileName < summaries[j].FileName
+	})
+	return summaries
+}
+
+// returns the summary of the file at path if it is indexed
+func (index *workspaceIndex) summary(path string) (*ModuleSummary, bool) {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+	summary, ok := index.summaries[path]
+	return summary, ok
+}
+
+// walks all folders and the Duden and returns
+// the modification times of all .ddp files by their filepath
+func (index *workspaceIndex) discover() map[string]time.Time {
+	index.mu.Lock()
+	folders := append([]string{ddppath.Duden}, index.folders...)
+	index.mu.Unlock()
+
+	found := make(map[string]time.Time)
+	for _, folder := range folders {
+		filepath.WalkDir(folder, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || filepath.Ext(path) != ".ddp" {
+				return nil
+			}
+
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+
+			path, err = filepath.Abs(path)
+			if err != nil {
+				return nil
+			}
+			found[path] = info.ModTime()
+			return nil
+		})
+	}
+	return found
+}
+
+// (re-)indexes every .ddp file that is new or changed since the last call
+// and removes the files that no longer exist
+// progress is called after every parsed file with the number of parsed files and the files to parse
+func (index *workspaceIndex) refresh(progress func(done, total int)) {
+	index.refreshMu.Lock()
+	defer index.refreshMu.Unlock()
+	// the cache files of removed or changed files are not used anymore
+	defer pruneCache()
+
+	found := index.discover()
+
+	index.mu.Lock()
+	removed := make([]string, 0)
+	for path := range index.summaries {
+		if _, ok := found[path]; !ok {
+			removed = append(removed, path)
+		}
+	}
+	index.mu.Unlock()
+
+	index.reindex(found, removed, progress)
+}
+
+// (re-)indexes the files at paths, which were created, changed or deleted
+// files that are not .ddp files or neither in the workspace folders nor the Duden are ignored
+func (index *workspaceIndex) update(paths []string) {
+	index.refreshMu.Lock()
+	defer index.refreshMu.Unlock()
+	defer pruneCache()
+
+	found := make(map[string]time.Time, len(paths))
+	removed := make([]string, 0)
+	for _, path := range paths {
+		path, err := filepath.Abs(path)
+		if err != nil || filepath.Ext(path) != ".ddp" || !index.contains(path) && !isDudenPath(path) {
+			continue
+		}
+
+		info, err := os.Stat(path)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			removed = append(removed, path)
+		case err == nil && !info.IsDir():
+			found[path] = info.ModTime()
+		}
+	}
+
+	index.reindex(found, removed, nil)
+}
+
+// removes the files at removed from the index and (re-)indexes
+// the files in found that are new or whose modification time changed
+// and the files that depend on one of them or on a removed file
+// files whose summary is cached are not parsed
+// index.refreshMu must be held
+func (index *workspaceIndex) reindex(found map[string]time.Time, removed []string, progress func(done, total int)) {
+	index.mu.Lock()
+	changed := make([]string, 0)
+	for path, modTime := range found {
+		if oldModTime, ok := index.modTimes[path]; !ok || !oldModTime.Equal(modTime) {
+			changed = append(changed, path)
+		}
+	}
+	for _, path := range removed {
+		delete(index.modules, path)
+		delete(index.modTimes, path)
+		delete(index.summaries, path)
+		removeCacheFile(index.cacheFiles[path])
+		delete(index.cacheFiles, path)
+	}
+	changed = index.withDependents(changed, removed)
+	index.mu.Unlock()
+
+	if len(changed) == 0 && len(removed) == 0 {
+		return
+	}
+	sort.Strings(changed)
+
+	// warm-start from the cache, only files without a cached summary are parsed
+	contents := make(map[string][]byte, len(changed))
+	toParse := make([]string, 0, len(changed))
+	for _, path := range changed {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			log.Warningf("could not index %s: %s", path, err)
+			continue
+		}
+
+		index.mu.Lock()
+		delete(index.modules, path)
+		if modTime, ok := found[path]; ok {
+			index.modTimes[path] = modTime
+		}
+		if cacheFile := cachePath(path, content); index.cacheFiles[path] != cacheFile {
+			removeCacheFile(index.cacheFiles[path])
+			index.cacheFiles[path] = cacheFile
+		}
+		index.mu.Unlock()
+
+		if summary, ok := loadSummary(path, content); ok {
+			index.mu.Lock()
+			index.summaries[path] = summary
+			index.mu.Unlock()
+			continue
+		}
+		contents[path] = content
+		toParse = append(toParse, path)
+	}
+
+	index.parseAll(toParse, contents, true, progress)
+}
+
+// returns paths and the indexed files that import or reference one of paths or removed,
+// directly or indirectly, as their modules and summaries still refer to the old declarations
+// index.mu must be held
+func (index *workspaceIndex) withDependents(paths, removed []string) []string {
+	visited := make(map[string]struct{}, len(paths)+len(removed))
+	for _, path := range slices.Concat(paths, removed) {
+		visited[path] = struct{}{}
+	}
+
+	queue := slices.Concat(paths, removed)
+	for len(queue) > 0 {
+		path := queue[0]
+		queue = queue[1:]
+		for file, summary := range index.summaries {
+			if _, ok := visited[file]; ok || !summary.references(path) {
+				continue
+			}
+			visited[file] = struct{}{}
+			paths = append(paths, file)
+			queue = append(queue, file)
+		}
+	}
+	return paths
+}
+
+// parses the files at paths that were only loaded from the cache
+// a running refresh is not waited for, so requests are not blocked while the workspace is indexed,
+// but files that another load is already parsing are not parsed again and waited for instead
+func (index *workspaceIndex) load(paths []string) {
+	done := make(chan struct{})
+	defer close(done)
+
+	index.mu.Lock()
+	toParse := make([]string, 0, len(paths))
+	waitFor := make([]chan struct{}, 0)
+	for _, path := range paths {
+		// another load might have parsed it in the meantime
+		_, parsed := index.modules[path]
+		_, indexed := index.summaries[path]
+		if parsed || !indexed {
+			continue
+		}
+		if loading, ok := index.loading[path]; ok {
+			waitFor = append(waitFor, loading)
+			continue
+		}
+		index.loading[path] = done
+		toParse = append(toParse, path)
+	}
+	index.mu.Unlock()
+
+	defer func() {
+		index.mu.Lock()
+		defer index.mu.Unlock()
+		for _, path := range toParse {
+			delete(index.loading, path)
+		}
+	}()
+
+	if len(toParse) > 0 {
+		index.loadContents(toParse)
+	}
+	for _, loading := range waitFor {
+		<-loading
+	}
+}
+
+// reads the files at paths and parses them
+func (index *workspaceIndex) loadContents(paths []string) {
+	contents := make(map[string][]byte, len(paths))
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			log.Warningf("could not parse %s: %s", path, err)
+			continue
+		}
+		contents[path] = content
+	}
+	// the summaries are already cached
+	index.parseAll(paths, contents, false, nil)
+}
+
+// parses the files at paths with the given contents in parallel and publishes their modules
+// the instantiations are collected again, even if paths is empty
+// the summaries of the files are written to the cache if store is set
+// files that are indexed again while they are parsed are not published, as their result is outdated
+func (index *workspaceIndex) parseAll(paths []string, contents map[string][]byte, store bool, progress func(done, total int)) {
+	index.mu.Lock()
+	modTimes := make(map[string]time.Time, len(paths))
+	for _, path := range paths {
+		modTimes[path] = index.modTimes[path]
+	}
+	index.mu.Unlock()
+	// index.mu must be held
+	isCurrent := func(path string) bool {
+		modTime, ok := index.modTimes[path]
+		return ok && modTime.Equal(modTimes[path])
+	}
+
+	pathChan := make(chan string)
+	done := 0
+	progressMu := sync.Mutex{} // progress is not called concurrently and guards parsed
+	// the modules are published after all workers finished,
+	// as a worker adds instantiations to the modules it parsed before
+	parsed := make(map[string]*ast.Module, len(paths))
+	wg := sync.WaitGroup{}
+	for range min(runtime.GOMAXPROCS(0), len(paths)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// every worker has its own modules, so that the parsers do not
+			// write to the same map or the same generic functions concurrently
+			modules := make(map[string]*ast.Module)
+			errs := make(map[string][]ddperror.Error)
+			for path := range pathChan {
+				var mod *ast.Module
+				if content, ok := contents[path]; ok {
+					var summary *ModuleSummary
+					mod, summary = index.parse(path, content, store, modules, errs)
+					index.mu.Lock()
+					if summary != nil && isCurrent(path) {
+						index.summaries[path] = summary
+					}
+					index.mu.Unlock()
+				}
+
+				progressMu.Lock()
+				if mod != nil {
+					parsed[path] = mod
+				}
+				done++
+				if progress != nil {
+					progress(done, len(paths))
+				}
+				progressMu.Unlock()
+			}
+		}()
+	}
+
+	for _, path := range paths {
+		pathChan <- path
+	}
+	close(pathChan)
+	wg.Wait()
+
+	index.mu.Lock()
+	defer index.mu.Unlock()
+	for path, mod := range parsed {
+		if isCurrent(path) {
+			index.modules[path] = mod
+		}
+	}
+	// no worker uses the modules anymore
+	mods := make([]*ast.Module, 0, len(index.modules))
+	for _, mod := range index.modules {
+		mods = append(mods, mod)
+	}
+	index.instantiations = collectInstantiations(mods...)
+}
+
+// parses the file at path and returns its module and summary
+// modules are the modules already parsed by the worker,
+// so files that were imported before are not parsed again
+// errs are the errors reported to the worker by their file
+func (index *workspaceIndex) parse(path string, content []byte, store bool, modules map[string]*ast.Module, errs map[string][]ddperror.Error) (*ast.Module, *ModuleSummary) {
+	mod := modules[path]
+	if mod == nil {
+		delete(modules, path)
+		var err error
+		mod, err = parser.Parse(parser.Options{
+			FileName: path,
+			Source:   content,
+			Modules:  modules,
+			ErrorHandler: func(err ddperror.Error) {
+				errs[err.File] = append(errs[err.File], err)
+			},
+		})
+		if err != nil {
+			log.Warningf("could not index %s: %s", path, err)
+			return nil, nil
+		}
+		modules[path] = mod
+	}
+
+	summary := summarize(mod, errs[path])
+	if store {
+		imports := importedPaths(mod)
+		delete(imports, path)
+		storeSummary(path, content, summary, imports)
+	}
+	return mod, summary
+}
@@ -0,0 +1,379 @@
+package documents
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DDP-Projekt/Kompilierer/src/ast"
+	"github.com/DDP-Projekt/Kompilierer/src/ddppath"
+)
+
+func TestWorkspaceIndexContains(t *testing.T) {
+	workspace := filepath.Join(t.TempDir(), "projekt")
+	tests := []struct {
+		folders []string
+		path    string
+		want    bool
+	}{
+		{nil, filepath.Join(workspace, "main.ddp"), true},
+		{nil, filepath.Join(ddppath.Duden, "Zeit.ddp"), false},
+		{[]string{workspace}, filepath.Join(workspace, "main.ddp"), true},
+		{[]string{workspace}, filepath.Join(workspace, "lib", "lib.ddp"), true},
+		{[]string{workspace}, filepath.Join(workspace+"2", "main.ddp"), false},
+		{[]string{workspace}, filepath.Join(filepath.Dir(workspace), "main.ddp"), false},
+		{[]string{workspace}, filepath.Join(ddppath.Duden, "Zeit.ddp"), false},
+	}
+	for _, test := range tests {
+		index := newWorkspaceIndex()
+		index.setFolders(test.folders)
+		if got := index.contains(test.path); got != test.want {
+			t.Errorf("contains(%s) with folders %v = %v, want %v", test.path, test.folders, got, test.want)
+		}
+	}
+}
+
+// a second index starts from the cached summaries and
+// only parses the files that are needed
+func TestWorkspaceIndexWarmStart(t *testing.T) {
+	CacheDir()
+	oldCacheDir := cacheDir
+	cacheDir = t.TempDir()
+	t.Cleanup(func() { cacheDir = oldCacheDir })
+
+	workspace := t.TempDir()
+	files := map[string]string{
+		"lib.ddp":   "Die öffentliche Zahl z ist 1.\n",
+		"main.ddp":  "Binde \"lib\" ein.\nDie Zahl x ist z.\n",
+		"other.ddp": "Die Zahl y ist 2.\n",
+	}
+	paths := make(map[string]string, len(files))
+	for name, content := range files {
+		paths[name] = filepath.Join(workspace, name)
+		if err := os.WriteFile(paths[name], []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cold := newWorkspaceIndex()
+	cold.setFolders([]string{workspace})
+	cold.refresh(nil)
+	for name, path := range paths {
+		if _, ok := cold.modules[path]; !ok {
+			t.Errorf("%s was not parsed", name)
+		}
+		if _, err := os.Stat(cold.cacheFiles[path]); err != nil {
+			t.Errorf("the summary of %s was not cached: %s", name, err)
+		}
+	}
+
+	warm := newWorkspaceIndex()
+	warm.setFolders([]string{workspace})
+	warm.refresh(nil)
+	for name, path := range paths {
+		if _, ok := warm.modules[path]; ok {
+			t.Errorf("%s was parsed although its summary is cached", name)
+		}
+		if _, ok := warm.summary(path); !ok {
+			t.Errorf("%s has no summary", name)
+		}
+	}
+
+	referencing := warm.snapshot(paths["lib.ddp"])
+	if len(referencing) != 2 || referencing[0].FileName != paths["lib.ddp"] || referencing[1].FileName != paths["main.ddp"] {
+		t.Errorf("got %d modules referencing lib.ddp, want lib.ddp and main.ddp", len(referencing))
+	}
+	if _, ok := warm.modules[paths["other.ddp"]]; ok {
+		t.Error("other.ddp was parsed although it does not reference lib.ddp")
+	}
+}
+
+// the cache files of changed and removed files are removed,
+// as well as cache files that were not used for a long time
+func TestWorkspaceIndexPruneCache(t *testing.T) {
+	CacheDir()
+	oldCacheDir := cacheDir
+	cacheDir = t.TempDir()
+	t.Cleanup(func() { cacheDir = oldCacheDir })
+
+	workspace := t.TempDir()
+	changed, removed := filepath.Join(workspace, "changed.ddp"), filepath.Join(workspace, "removed.ddp")
+	for _, path := range []string{changed, removed} {
+		if err := os.WriteFile(path, []byte("Die Zahl x ist 1.\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	unused := filepath.Join(cacheDir, "unused.json")
+	if err := os.WriteFile(unused, []byte("{}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	longAgo := time.Now().Add(-2 * maxCacheAge)
+	if err := os.Chtimes(unused, longAgo, longAgo); err != nil {
+		t.Fatal(err)
+	}
+
+	index := newWorkspaceIndex()
+	index.setFolders([]string{workspace})
+	index.refresh(nil)
+	oldChanged, oldRemoved := index.cacheFiles[changed], index.cacheFiles[removed]
+
+	if err := os.WriteFile(changed, []byte("Die Zahl x ist 2.\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// the modification time might not change on file systems with a coarse resolution
+	if err := os.Chtimes(changed, time.Now(), time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(removed); err != nil {
+		t.Fatal(err)
+	}
+	index.refresh(nil)
+
+	for _, file := range []string{oldChanged, oldRemoved, unused} {
+		if _, err := os.Stat(file); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("%s was not pruned", file)
+		}
+	}
+	if _, err := os.Stat(index.cacheFiles[changed]); err != nil {
+		t.Errorf("the new summary of the changed file was not cached: %s", err)
+	}
+}
+
+// only the given files are indexed again
+func TestWorkspaceIndexUpdate(t *testing.T) {
+	CacheDir()
+	oldCacheDir := cacheDir
+	cacheDir = t.TempDir()
+	t.Cleanup(func() { cacheDir = oldCacheDir })
+
+	workspace := t.TempDir()
+	path := func(name string) string { return filepath.Join(workspace, name) }
+	write := func(name, content string) {
+		if err := os.WriteFile(path(name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		// the modification time might not change on file systems with a coarse resolution
+		modTime := time.Now().Add(time.Second)
+		if err := os.Chtimes(path(name), modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("changed.ddp", "Die Zahl x ist 1.\n")
+	write("removed.ddp", "Die Zahl x ist 1.\n")
+	write("untouched.ddp", "Die Zahl x ist 1.\n")
+
+	index := newWorkspaceIndex()
+	index.setFolders([]string{workspace})
+	index.refresh(nil)
+
+	write("changed.ddp", "Die Zahl y ist 1.\n")
+	write("untouched.ddp", "Die Zahl y ist 1.\n")
+	write("created.ddp", "Die Zahl y ist 1.\n")
+	if err := os.Remove(path("removed.ddp")); err != nil {
+		t.Fatal(err)
+	}
+	index.update([]string{path("changed.ddp"), path("created.ddp"), path("removed.ddp"), filepath.Join(t.TempDir(), "outside.ddp")})
+
+	declName := func(name string) string {
+		summary, ok := index.summary(path(name))
+		if !ok || len(summary.Declarations) == 0 {
+			return ""
+		}
+		return summary.Declarations[0].Name
+	}
+	if got := declName("changed.ddp"); got != "y" {
+		t.Errorf("changed.ddp declares %q, want y", got)
+	}
+	if got := declName("created.ddp"); got != "y" {
+		t.Errorf("created.ddp declares %q, want y", got)
+	}
+	if got := declName("untouched.ddp"); got != "x" {
+		t.Errorf("untouched.ddp declares %q, want x as it was not updated", got)
+	}
+	if _, ok := index.summary(path("removed.ddp")); ok {
+		t.Error("removed.ddp is still indexed")
+	}
+	if len(index.allSummaries()) != 3 {
+		t.Errorf("got %d indexed files, want 3", len(index.allSummaries()))
+	}
+}
+
+// files that import an updated file are indexed again,
+// so that their references follow the moved declarations
+func TestWorkspaceIndexUpdateDependents(t *testing.T) {
+	CacheDir()
+	oldCacheDir := cacheDir
+	cacheDir = t.TempDir()
+	t.Cleanup(func() { cacheDir = oldCacheDir })
+
+	workspace := t.TempDir()
+	path := func(name string) string { return filepath.Join(workspace, name) }
+	write := func(name, content string) {
+		if err := os.WriteFile(path(name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		// the modification time might not change on file systems with a coarse resolution
+		modTime := time.Now().Add(time.Second)
+		if err := os.Chtimes(path(name), modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("b.ddp", "Die öffentliche Zahl z ist 1.\n")
+	write("c.ddp", "Binde \"b\" ein.\nDie öffentliche Zahl x ist z.\n")
+	write("d.ddp", "Binde \"c\" ein.\nDie Zahl y ist x.\n")
+	write("other.ddp", "Die Zahl z ist 1.\n")
+
+	index := newWorkspaceIndex()
+	index.setFolders([]string{workspace})
+	index.refresh(nil)
+	oldD, oldOther := index.modules[path("d.ddp")], index.modules[path("other.ddp")]
+
+	write("b.ddp", "Die öffentliche Zahl a ist 2.\nDie öffentliche Zahl z ist 1.\n")
+	index.update([]string{path("b.ddp")})
+
+	b, _ := index.summary(path("b.ddp"))
+	if len(b.Declarations) != 2 {
+		t.Fatalf("got %d declarations in b.ddp, want 2", len(b.Declarations))
+	}
+	var c *ast.Module
+	for _, mod := range index.snapshot(path("b.ddp")) {
+		if mod.FileName == path("c.ddp") {
+			c = mod
+		}
+	}
+	if c == nil {
+		t.Fatal("c.ddp does not reference b.ddp")
+	}
+	found := false
+	ast.VisitModule(c, ast.IdentVisitorFunc(func(ident *ast.Ident) ast.VisitResult {
+		if decl, ok := ident.Declaration.(*ast.VarDecl); ok && decl.Name() == "z" {
+			found = true
+			if decl.NameTok.Range != b.Declarations[1].Range {
+				t.Errorf("z in c.ddp refers to %v, want %v", decl.NameTok.Range, b.Declarations[1].Range)
+			}
+		}
+		return ast.VisitRecurse
+	}))
+	if !found {
+		t.Error("z in c.ddp was not resolved")
+	}
+
+	if index.modules[path("d.ddp")] == oldD {
+		t.Error("d.ddp was not indexed again although it imports c.ddp indirectly")
+	}
+	if index.modules[path("other.ddp")] != oldOther {
+		t.Error("other.ddp was indexed again although it does not depend on b.ddp")
+	}
+
+	write("b.ddp", "Die öffentliche Zahl a ist 2.\n")
+	index.update([]string{path("b.ddp")})
+	if summary, _ := index.summary(path("c.ddp")); len(summary.Diagnostics) == 0 {
+		t.Error("c.ddp does not report the removed declaration of b.ddp")
+	}
+}
+
+// the summary of a module is not loaded from the cache
+// if one of its imports changed while the server was not running
+func TestWorkspaceIndexWarmStartChangedImport(t *testing.T) {
+	CacheDir()
+	oldCacheDir := cacheDir
+	cacheDir = t.TempDir()
+	t.Cleanup(func() { cacheDir = oldCacheDir })
+
+	workspace := t.TempDir()
+	lib, main := filepath.Join(workspace, "lib.ddp"), filepath.Join(workspace, "main.ddp")
+	write := func(path, content string) {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		// the modification time might not change on file systems with a coarse resolution
+		modTime := time.Now().Add(time.Second)
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(lib, "Die öffentliche Zahl z ist 1.\n")
+	write(main, "Binde \"lib\" ein.\nDie Zahl x ist z.\n")
+
+	cold := newWorkspaceIndex()
+	cold.setFolders([]string{workspace})
+	cold.refresh(nil)
+	if summary, _ := cold.summary(main); len(summary.Diagnostics) != 0 {
+		t.Fatalf("main.ddp has unexpected errors: %v", summary.Diagnostics)
+	}
+
+	write(lib, "Die öffentliche Zahl y ist 1.\n")
+
+	warm := newWorkspaceIndex()
+	warm.setFolders([]string{workspace})
+	warm.refresh(nil)
+	if _, ok := warm.modules[main]; !ok {
+		t.Error("main.ddp was loaded from the cache although lib.ddp changed")
+	}
+	if summary, _ := warm.summary(main); len(summary.Diagnostics) == 0 {
+		t.Error("main.ddp does not report the removed declaration of lib.ddp")
+	}
+
+	again := newWorkspaceIndex()
+	again.setFolders([]string{workspace})
+	again.refresh(nil)
+	if _, ok := again.modules[main]; ok {
+		t.Error("main.ddp was parsed although its summary with the new lib.ddp is cached")
+	}
+}
+
+// modules are parsed on demand while a refresh is running
+// and concurrent loads of the same files share their results
+func TestWorkspaceIndexLoadDuringRefresh(t *testing.T) {
+	CacheDir()
+	oldCacheDir := cacheDir
+	cacheDir = t.TempDir()
+	t.Cleanup(func() { cacheDir = oldCacheDir })
+
+	workspace := t.TempDir()
+	lib, main := filepath.Join(workspace, "lib.ddp"), filepath.Join(workspace, "main.ddp")
+	if err := os.WriteFile(lib, []byte("Die öffentliche Zahl z ist 1.\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(main, []byte("Binde \"lib\" ein.\nDie Zahl x ist z.\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cold := newWorkspaceIndex()
+	cold.setFolders([]string{workspace})
+	cold.refresh(nil)
+
+	index := newWorkspaceIndex()
+	index.setFolders([]string{workspace})
+	index.refresh(nil)
+	if _, ok := index.modules[main]; ok {
+		t.Fatal("main.ddp was parsed although its summary is cached")
+	}
+
+	// simulate a running refresh
+	index.refreshMu.Lock()
+	defer index.refreshMu.Unlock()
+
+	const loads = 4
+	results := make(chan []*ast.Module, loads)
+	for range loads {
+		go func() { results <- index.snapshot(lib) }()
+	}
+	for range loads {
+		select {
+		case modules := <-results:
+			if len(modules) != 2 {
+				t.Errorf("got %d modules referencing lib.ddp, want 2", len(modules))
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("the load waits for the refresh")
+		}
+	}
+	if len(index.loading) != 0 {
+		t.Errorf("%d files are still marked as loading", len(index.loading))
+	}
+}
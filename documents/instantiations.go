@@ -0,0 +1,65 @@
+package documents
+
+import (
+	"slices"
+
+	"github.com/DDP-Projekt/Kompilierer/src/ast"
+)
+
+// the instantiations of generic functions at the time a snapshot was created
+// the instantiations of the module that declares a function come first
+// the parser adds instantiations to the generic functions of every module it imports,
+// which includes the shared Duden modules and open documents,
+// so FuncDecl.Generic.Instantiations must only be read while parsing
+type Instantiations map[*ast.FuncDecl][]*ast.FuncDecl
+
+// copies the instantiations of all generic functions declared in mods and the modules they import
+// must only be called while the paths of these modules are locked
+func collectInstantiations(mods ...*ast.Module) Instantiations {
+	inst := make(Instantiations)
+	collect := func(mod *ast.Module) {
+		for _, stmt := range mod.Ast.Statements {
+			declStmt, ok := stmt.(*ast.DeclStmt)
+			if !ok {
+				continue
+			}
+			decl, ok := declStmt.Decl.(*ast.FuncDecl)
+			if !ok || !ast.IsGeneric(decl) {
+				continue
+			}
+			if _, ok := inst[decl]; ok {
+				continue
+			}
+
+			own := decl.Generic.Instantiations[decl.Mod]
+			instantiations := slices.Clone(own)
+			for m, others := range decl.Generic.Instantiations {
+				if m != decl.Mod {
+					instantiations = append(instantiations, others...)
+				}
+			}
+			inst[decl] = instantiations
+		}
+	}
+
+	for _, mod := range mods {
+		if mod == nil {
+			continue
+		}
+		collect(mod)
+		visitImports(mod, collect)
+	}
+	return inst
+}
+
+// adds the instantiations of other to inst and returns inst
+func (inst Instantiations) Merge(other Instantiations) Instantiations {
+	for decl, instantiations := range other {
+		for _, instantiation := range instantiations {
+			if !slices.Contains(inst[decl], instantiation) {
+				inst[decl] = append(inst[decl], instantiation)
+			}
+		}
+	}
+	return inst
+}
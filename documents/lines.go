@@ -0,0 +1,220 @@
+package documents
+
+import (
+	"slices"
+	"sort"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/DDP-Projekt/Kompilierer/src/token"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// the position encodings of LSP 3.17
+// they define in which code units the characters of a protocol.Position are counted
+type PositionEncoding string
+
+const (
+	PositionEncodingUTF8  PositionEncoding = "utf-8"
+	PositionEncodingUTF16 PositionEncoding = "utf-16" // the default that every client supports
+	PositionEncodingUTF32 PositionEncoding = "utf-32" // counts runes, just like the columns of tokens
+)
+
+// returns the number of code units of r in enc
+func (enc PositionEncoding) runeLen(r rune) int {
+	switch enc {
+	case PositionEncodingUTF8:
+		return utf8.RuneLen(r)
+	case PositionEncodingUTF32:
+		return 1
+	}
+	return utf16.RuneLen(r)
+}
+
+// the offsets at which the lines of a text start
+// converts between byte offsets, token.Positions (1-based, columns in runes)
+// and protocol.Positions (0-based, characters in the code units of a PositionEncoding)
+// lines are found by index or binary search, so only the line of a position is scanned
+type lineIndex[T string | []byte] struct {
+	text   T
+	starts []int // the byte offset of every line, starts[0] is always 0
+}
+
+// the line index of a snapshot
+type LineIndex = lineIndex[string]
+
+func NewLineIndex(text string) *LineIndex {
+	return newLineIndex(text)
+}
+
+func newLineIndex[T string | []byte](text T) *lineIndex[T] {
+	starts := make([]int, 1, len(text)/32+1)
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			starts = append(starts, i+1)
+		}
+	}
+	return &lineIndex[T]{text: text, starts: starts}
+}
+
+// returns the byte range of the 0-based line without its line break
+// the '\r' of a CRLF line break is not part of the line
+// lines after the last line are empty and at the end of the text
+func (l *lineIndex[T]) line(line int) (int, int) {
+	if line < 0 {
+		return 0, 0
+	}
+	if line >= len(l.starts) {
+		return len(l.text), len(l.text)
+	}
+	if line+1 < len(l.starts) {
+		end := l.starts[line+1] - 1
+		if end > l.starts[line] && l.text[end-1] == '\r' {
+			end--
+		}
+		return l.starts[line], end
+	}
+	return l.starts[line], len(l.text)
+}
+
+// returns the 0-based line that contains offset
+func (l *lineIndex[T]) lineOf(offset int) int {
+	offset = min(max(offset, 0), len(l.text))
+	return sort.SearchInts(l.starts, offset+1) - 1
+}
+
+// returns the 0-based line of offset, the start of that line
+// and offset clamped to the text and the end of the line
+func (l *lineIndex[T]) clamp(offset int) (int, int, int) {
+	offset = min(max(offset, 0), len(l.text))
+	line := l.lineOf(offset)
+	start, end := l.line(line)
+	return line, start, min(offset, end)
+}
+
+// returns the byte offset of pos
+// columns behind the end of the line are clamped to it
+func (l *lineIndex[T]) Offset(pos token.Position) int {
+	start, end := l.line(int(pos.Line) - 1)
+	column := 1
+	for i := range string(l.text[start:end]) {
+		if column >= int(pos.Column) {
+			return start + i
+		}
+		column++
+	}
+	return end
+}
+
+// returns the token.Position of offset
+// offsets inside a line break are clamped to the end of the line
+func (l *lineIndex[T]) Position(offset int) token.Position {
+	line, start, offset := l.clamp(offset)
+	column := 1
+	for range string(l.text[start:offset]) {
+		column++
+	}
+	return token.Position{Line: uint(line + 1), Column: uint(column)}
+}
+
+// returns the byte offset of pos, whose characters are counted in enc
+// characters behind the end of the line are clamped to it
+func (l *lineIndex[T]) ProtocolOffset(pos protocol.Position, enc PositionEncoding) int {
+	start, end := l.line(int(pos.Line))
+	if enc == PositionEncodingUTF8 {
+		offset := min(start+int(pos.Character), end)
+		for offset > start && offset < end && !utf8.RuneStart(l.text[offset]) {
+			offset--
+		}
+		return offset
+	}
+
+	character := 0
+	for i, r := range string(l.text[start:end]) {
+		// a position in the middle of a rune points before it
+		if character+enc.runeLen(r) > int(pos.Character) {
+			return start + i
+		}
+		character += enc.runeLen(r)
+	}
+	return end
+}
+
+// returns the protocol.Position of offset with characters counted in enc
+// offsets inside a line break are clamped to the end of the line
+func (l *lineIndex[T]) ProtocolPosition(offset int, enc PositionEncoding) protocol.Position {
+	line, start, offset := l.clamp(offset)
+	if enc == PositionEncodingUTF8 {
+		return protocol.Position{Line: protocol.UInteger(line), Character: protocol.UInteger(offset - start)}
+	}
+
+	character := 0
+	for _, r := range string(l.text[start:offset]) {
+		character += enc.runeLen(r)
+	}
+	return protocol.Position{Line: protocol.UInteger(line), Character: protocol.UInteger(character)}
+}
+
+// converts a protocol.Position in enc into a token.Position
+func (l *lineIndex[T]) FromProtocolPosition(pos protocol.Position, enc PositionEncoding) token.Position {
+	return l.Position(l.ProtocolOffset(pos, enc))
+}
+
+// converts a token.Position into a protocol.Position in enc
+func (l *lineIndex[T]) ToProtocolPosition(pos token.Position, enc PositionEncoding) protocol.Position {
+	return l.ProtocolPosition(l.Offset(pos), enc)
+}
+
+// converts a token.Range into a protocol.Range in enc
+func (l *lineIndex[T]) ToProtocolRange(rang token.Range, enc PositionEncoding) protocol.Range {
+	return protocol.Range{
+		Start: l.ToProtocolPosition(rang.Start, enc),
+		End:   l.ToProtocolPosition(rang.End, enc),
+	}
+}
+
+// returns the text of rang
+func (l *lineIndex[T]) Slice(rang token.Range) T {
+	start, end := l.Offset(rang.Start), l.Offset(rang.End)
+	if end < start {
+		return l.text[start:start]
+	}
+	return l.text[start:end]
+}
+
+// returns the number of code units of enc in rang, without line breaks
+func (l *lineIndex[T]) Length(rang token.Range, enc PositionEncoding) int {
+	length := 0
+	for _, r := range string(l.Slice(rang)) {
+		if r != '\n' && r != '\r' {
+			length += enc.runeLen(r)
+		}
+	}
+	return length
+}
+
+// replaces the bytes of l from start to end with text
+// the buffer is edited in place and only the line starts behind start are updated,
+// so that incremental changes do not rebuild the whole text
+func replaceText(l *lineIndex[[]byte], start, end int, text string) {
+	start = min(max(start, 0), len(l.text))
+	end = min(max(end, start), len(l.text))
+
+	// the lines that start inside the replaced bytes
+	first := sort.SearchInts(l.starts, start+1)
+	last := sort.SearchInts(l.starts, end+1)
+
+	inserted := make([]int, 0)
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			inserted = append(inserted, start+i+1)
+		}
+	}
+
+	delta := len(text) - (end - start)
+	for i := last; i < len(l.starts); i++ {
+		l.starts[i] += delta
+	}
+	l.starts = slices.Replace(l.starts, first, last, inserted...)
+	l.text = slices.Replace(l.text, start, end, []byte(text)...)
+}
@@ -0,0 +1,162 @@
+package documents
+
+import (
+	"testing"
+
+	"github.com/DDP-Projekt/Kompilierer/src/token"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// byte offsets of the lines:
+// 0: "Die Zahl ä ist 1." 0-17, '\r' 18, '\n' 19 (ä is 9-10)
+// 1: "😀 und ß"          20-30, '\r' 31, '\n' 32 (😀 is 20-23, ß is 29-30)
+// 2: ""                  '\n' 33
+// 3: "ende"              34-37, end of text 38
+const testText = "Die Zahl ä ist 1.\r\n😀 und ß\r\n\nende"
+
+func TestOffset(t *testing.T) {
+	lines := NewLineIndex(testText)
+	tests := []struct {
+		pos  token.Position
+		want int
+	}{
+		{token.Position{Line: 1, Column: 1}, 0},
+		{token.Position{Line: 1, Column: 10}, 9},
+		{token.Position{Line: 1, Column: 11}, 11},
+		{token.Position{Line: 1, Column: 18}, 18}, // end of line
+		{token.Position{Line: 1, Column: 50}, 18}, // past the end of line
+		{token.Position{Line: 2, Column: 1}, 20},
+		{token.Position{Line: 2, Column: 2}, 24},
+		{token.Position{Line: 2, Column: 8}, 31},
+		{token.Position{Line: 3, Column: 1}, 33},
+		{token.Position{Line: 3, Column: 5}, 33},
+		{token.Position{Line: 4, Column: 5}, 38}, // end of file
+		{token.Position{Line: 5, Column: 1}, 38}, // past the end of file
+		{token.Position{Line: 9, Column: 9}, 38},
+	}
+	for _, test := range tests {
+		if got := lines.Offset(test.pos); got != test.want {
+			t.Errorf("Offset(%v) = %d, want %d", test.pos, got, test.want)
+		}
+	}
+}
+
+func TestPosition(t *testing.T) {
+	lines := NewLineIndex(testText)
+	tests := []struct {
+		offset int
+		want   token.Position
+	}{
+		{-1, token.Position{Line: 1, Column: 1}},
+		{0, token.Position{Line: 1, Column: 1}},
+		{11, token.Position{Line: 1, Column: 11}},
+		{18, token.Position{Line: 1, Column: 18}}, // '\r'
+		{19, token.Position{Line: 1, Column: 18}}, // '\n'
+		{20, token.Position{Line: 2, Column: 1}},
+		{24, token.Position{Line: 2, Column: 2}},
+		{31, token.Position{Line: 2, Column: 8}},
+		{32, token.Position{Line: 2, Column: 8}},
+		{33, token.Position{Line: 3, Column: 1}},
+		{38, token.Position{Line: 4, Column: 5}}, // end of file
+		{100, token.Position{Line: 4, Column: 5}},
+	}
+	for _, test := range tests {
+		if got := lines.Position(test.offset); got != test.want {
+			t.Errorf("Position(%d) = %v, want %v", test.offset, got, test.want)
+		}
+	}
+}
+
+func TestProtocolOffset(t *testing.T) {
+	lines := NewLineIndex(testText)
+	tests := []struct {
+		enc  PositionEncoding
+		pos  protocol.Position
+		want int
+	}{
+		{PositionEncodingUTF8, protocol.Position{Line: 0, Character: 10}, 9}, // inside ä
+		{PositionEncodingUTF8, protocol.Position{Line: 0, Character: 11}, 11},
+		{PositionEncodingUTF8, protocol.Position{Line: 0, Character: 18}, 18},
+		{PositionEncodingUTF8, protocol.Position{Line: 0, Character: 30}, 18},
+		{PositionEncodingUTF8, protocol.Position{Line: 1, Character: 2}, 20}, // inside 😀
+		{PositionEncodingUTF8, protocol.Position{Line: 1, Character: 4}, 24},
+		{PositionEncodingUTF8, protocol.Position{Line: 1, Character: 11}, 31},
+		{PositionEncodingUTF8, protocol.Position{Line: 1, Character: 20}, 31},
+		{PositionEncodingUTF8, protocol.Position{Line: 3, Character: 4}, 38},
+		{PositionEncodingUTF8, protocol.Position{Line: 5, Character: 0}, 38},
+
+		{PositionEncodingUTF16, protocol.Position{Line: 0, Character: 10}, 11},
+		{PositionEncodingUTF16, protocol.Position{Line: 0, Character: 17}, 18},
+		{PositionEncodingUTF16, protocol.Position{Line: 0, Character: 30}, 18},
+		{PositionEncodingUTF16, protocol.Position{Line: 1, Character: 1}, 20}, // inside the surrogate pair
+		{PositionEncodingUTF16, protocol.Position{Line: 1, Character: 2}, 24},
+		{PositionEncodingUTF16, protocol.Position{Line: 1, Character: 8}, 31},
+		{PositionEncodingUTF16, protocol.Position{Line: 1, Character: 20}, 31},
+		{PositionEncodingUTF16, protocol.Position{Line: 2, Character: 3}, 33},
+		{PositionEncodingUTF16, protocol.Position{Line: 4, Character: 0}, 38},
+
+		{PositionEncodingUTF32, protocol.Position{Line: 0, Character: 10}, 11},
+		{PositionEncodingUTF32, protocol.Position{Line: 0, Character: 17}, 18},
+		{PositionEncodingUTF32, protocol.Position{Line: 1, Character: 1}, 24},
+		{PositionEncodingUTF32, protocol.Position{Line: 1, Character: 7}, 31},
+		{PositionEncodingUTF32, protocol.Position{Line: 1, Character: 9}, 31},
+		{PositionEncodingUTF32, protocol.Position{Line: 3, Character: 9}, 38},
+	}
+	for _, test := range tests {
+		if got := lines.ProtocolOffset(test.pos, test.enc); got != test.want {
+			t.Errorf("ProtocolOffset(%v, %s) = %d, want %d", test.pos, test.enc, got, test.want)
+		}
+	}
+}
+
+func TestProtocolPosition(t *testing.T) {
+	lines := NewLineIndex(testText)
+	tests := []struct {
+		offset             int
+		utf8, utf16, utf32 protocol.Position
+	}{
+		{0, protocol.Position{Line: 0, Character: 0}, protocol.Position{Line: 0, Character: 0}, protocol.Position{Line: 0, Character: 0}},
+		{11, protocol.Position{Line: 0, Character: 11}, protocol.Position{Line: 0, Character: 10}, protocol.Position{Line: 0, Character: 10}},
+		{18, protocol.Position{Line: 0, Character: 18}, protocol.Position{Line: 0, Character: 17}, protocol.Position{Line: 0, Character: 17}},
+		{19, protocol.Position{Line: 0, Character: 18}, protocol.Position{Line: 0, Character: 17}, protocol.Position{Line: 0, Character: 17}},
+		{24, protocol.Position{Line: 1, Character: 4}, protocol.Position{Line: 1, Character: 2}, protocol.Position{Line: 1, Character: 1}},
+		{31, protocol.Position{Line: 1, Character: 11}, protocol.Position{Line: 1, Character: 8}, protocol.Position{Line: 1, Character: 7}},
+		{33, protocol.Position{Line: 2, Character: 0}, protocol.Position{Line: 2, Character: 0}, protocol.Position{Line: 2, Character: 0}},
+		{38, protocol.Position{Line: 3, Character: 4}, protocol.Position{Line: 3, Character: 4}, protocol.Position{Line: 3, Character: 4}},
+		{100, protocol.Position{Line: 3, Character: 4}, protocol.Position{Line: 3, Character: 4}, protocol.Position{Line: 3, Character: 4}},
+	}
+	for _, test := range tests {
+		for enc, want := range map[PositionEncoding]protocol.Position{
+			PositionEncodingUTF8:  test.utf8,
+			PositionEncodingUTF16: test.utf16,
+			PositionEncodingUTF32: test.utf32,
+		} {
+			if got := lines.ProtocolPosition(test.offset, enc); got != want {
+				t.Errorf("ProtocolPosition(%d, %s) = %v, want %v", test.offset, enc, got, want)
+			}
+		}
+	}
+}
+
+func TestFromProtocolPosition(t *testing.T) {
+	lines := NewLineIndex(testText)
+	tests := []struct {
+		enc  PositionEncoding
+		pos  protocol.Position
+		want token.Position
+	}{
+		{PositionEncodingUTF8, protocol.Position{Line: 0, Character: 10}, token.Position{Line: 1, Column: 10}},
+		{PositionEncodingUTF8, protocol.Position{Line: 0, Character: 11}, token.Position{Line: 1, Column: 11}},
+		{PositionEncodingUTF8, protocol.Position{Line: 1, Character: 11}, token.Position{Line: 2, Column: 8}},
+		{PositionEncodingUTF16, protocol.Position{Line: 0, Character: 17}, token.Position{Line: 1, Column: 18}},
+		{PositionEncodingUTF16, protocol.Position{Line: 1, Character: 2}, token.Position{Line: 2, Column: 2}},
+		{PositionEncodingUTF16, protocol.Position{Line: 9, Character: 0}, token.Position{Line: 4, Column: 5}},
+		{PositionEncodingUTF32, protocol.Position{Line: 1, Character: 50}, token.Position{Line: 2, Column: 8}},
+		{PositionEncodingUTF32, protocol.Position{Line: 2, Character: 0}, token.Position{Line: 3, Column: 1}},
+	}
+	for _, test := range tests {
+		if got := lines.FromProtocolPosition(test.pos, test.enc); got != test.want {
+			t.Errorf("FromProtocolPosition(%v, %s) = %v, want %v", test.pos, test.enc, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package documents
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/DDP-Projekt/Kompilierer/src/ast"
+)
+
+// a mutex for every file
+// a parse locks its document and every module it might import,
+// as the parser adds generic instantiations to the imported modules
+// parses of documents that do not share any modules run in parallel
+type pathLocks struct {
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+func newPathLocks() *pathLocks {
+	return &pathLocks{
+		locks: make(map[string]*sync.Mutex),
+	}
+}
+
+// locks all paths and returns a function that unlocks them again
+// the paths are locked in sorted order, so that two calls cannot deadlock
+func (l *pathLocks) lock(paths map[string]struct{}) (unlock func()) {
+	sorted := make([]string, 0, len(paths))
+	for path := range paths {
+		sorted = append(sorted, path)
+	}
+	slices.Sort(sorted)
+
+	l.mu.Lock()
+	mutexes := make([]*sync.Mutex, 0, len(sorted))
+	for _, path := range sorted {
+		mu, ok := l.locks[path]
+		if !ok {
+			mu = &sync.Mutex{}
+			l.locks[path] = mu
+		}
+		mutexes = append(mutexes, mu)
+	}
+	l.mu.Unlock()
+
+	for _, mu := range mutexes {
+		mu.Lock()
+	}
+	return func() {
+		for _, mu := range slices.Backward(mutexes) {
+			mu.Unlock()
+		}
+	}
+}
+
+// returns the filepaths of mod and every module it imports directly or indirectly
+func importedPaths(mod *ast.Module) map[string]struct{} {
+	paths := map[string]struct{}{mod.FileName: {}}
+	visitImports(mod, func(imported *ast.Module) {
+		paths[imported.FileName] = struct{}{}
+	})
+	return paths
+}
@@ -4,6 +4,7 @@ go 1.24.0
 
 require (
 	github.com/DDP-Projekt/Kompilierer v1.0.0
+	github.com/sourcegraph/jsonrpc2 v0.2.0
 	github.com/tliron/commonlog v0.2.18
 	github.com/tliron/glsp v0.2.2-0.20240309182338-ab78d718ad7d
 )
@@ -21,7 +22,6 @@ require (
 	github.com/rivo/uniseg v0.4.2 // indirect
 	github.com/sasha-s/go-deadlock v0.3.1 // indirect
 	github.com/segmentio/ksuid v1.0.4 // indirect
-	github.com/sourcegraph/jsonrpc2 v0.2.0 // indirect
 	github.com/tliron/kutil v0.3.25 // indirect
 	golang.org/x/crypto v0.32.0 // indirect
 	golang.org/x/sys v0.29.0 // indirect
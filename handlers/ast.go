@@ -27,6 +27,11 @@ func CreateAstRequestHandler(dm *documents.DocumentManager) protocol.CustomReque
 			return nil, fmt.Errorf("%s not in document map", req.Path)
 		}
 
+		if req.Range != nil {
+			rang := decodeRange(dm, act, *req.Range)
+			req.Range = &rang
+		}
+
 		items := make([]TreeItem, 0)
 		for _, v := range act.Module.Ast.Statements {
 			stmtRange := helper.ToProtocolRange(v.GetRange())
@@ -38,10 +43,18 @@ func CreateAstRequestHandler(dm *documents.DocumentManager) protocol.CustomReque
 				continue
 			}
 
-			items = append(items, makeTreeNode(v))
+			items = append(items, makeTreeNode(v, act.Instantiations))
 		}
-		return items, nil
+		return encodeTreeItems(newEncoder(dm, act), act, items), nil
+	}
+}
+
+func encodeTreeItems(enc *encoder, doc *documents.DocumentState, items []TreeItem) []TreeItem {
+	for i := range items {
+		items[i].Range = enc.rang(doc.Uri, items[i].Range)
+		items[i].Children = encodeTreeItems(enc, doc, items[i].Children)
 	}
+	return items
 }
 
 type TreeItem struct {
@@ -85,7 +98,7 @@ func NewNodeItem(node ast.Node, description string, children []TreeItem, iconID
 	}
 }
 
-func makeTreeNode(node ast.Node) TreeItem {
+func makeTreeNode(node ast.Node, instantiations documents.Instantiations) TreeItem {
 	if node == nil {
 		panic("nil Node passed into makeTreeNode()")
 	}
@@ -99,16 +112,16 @@ func makeTreeNode(node ast.Node) TreeItem {
 		assertNode("Indexing.Lhs", node.Lhs)
 		assertNode("Indexing.Index", node.Index)
 		return NewNodeItem(node, "", []TreeItem{
-			makeTreeNode(node.Lhs),
-			makeTreeNode(node.Index),
+			makeTreeNode(node.Lhs, instantiations),
+			makeTreeNode(node.Index, instantiations),
 		}, "symbol-array")
 
 	case *ast.FieldAccess:
 		assertNode("FieldAccess.Field", node.Field)
 		assertNode("FieldAccess.Rhs", node.Rhs)
 		return NewNodeItem(node, "", []TreeItem{
-			makeTreeNode(node.Field),
-			makeTreeNode(node.Rhs),
+			makeTreeNode(node.Field, instantiations),
+			makeTreeNode(node.Rhs, instantiations),
 		}, "symbol-field")
 	case *ast.IntLit:
 		return NewNodeItem(node, fmt.Sprintf("%d", node.Value), nil, "symbol-number")
@@ -125,22 +138,22 @@ func makeTreeNode(node ast.Node) TreeItem {
 			assertNode("ListLit.Count", node.Count)
 			assertNode("ListLit.Value", node.Value)
 			return NewNodeItem(node, node.Type.String(), []TreeItem{
-				makeTreeNode(node.Count),
-				makeTreeNode(node.Value),
+				makeTreeNode(node.Count, instantiations),
+				makeTreeNode(node.Value, instantiations),
 			}, "symbol-array")
 		}
 
 		vals := make([]TreeItem, 0)
 		for _, v := range node.Values {
 			assertNode("ListLit.Values.Value", v)
-			vals = append(vals, makeTreeNode(v))
+			vals = append(vals, makeTreeNode(v, instantiations))
 		}
 
 		return NewNodeItem(node, node.Type.String(), vals, "symbol-array")
 	case *ast.UnaryExpr:
 		assertNode("UnaryExpr.Rhs", node.Rhs)
 		children := []TreeItem{
-			makeTreeNode(node.Rhs),
+			makeTreeNode(node.Rhs, instantiations),
 		}
 		if node.OverloadedBy != nil {
 			children = append(children, NewDataItem("OverloadedBy", node.OverloadedBy.Decl.Name(), nil))
@@ -151,8 +164,8 @@ func makeTreeNode(node ast.Node) TreeItem {
 		assertNode("BinaryExpr.Lhs", node.Lhs)
 		assertNode("BinaryExpr.Rhs", node.Rhs)
 		children := []TreeItem{
-			makeTreeNode(node.Lhs),
-			makeTreeNode(node.Rhs),
+			makeTreeNode(node.Lhs, instantiations),
+			makeTreeNode(node.Rhs, instantiations),
 		}
 		if node.OverloadedBy != nil {
 			children = append(children, NewDataItem("OverloadedBy", node.OverloadedBy.Decl.Name(), nil))
@@ -164,9 +177,9 @@ func makeTreeNode(node ast.Node) TreeItem {
 		assertNode("TernaryExpr.Mid", node.Mid)
 		assertNode("TernaryExpr.Rhs", node.Rhs)
 		children := []TreeItem{
-			makeTreeNode(node.Lhs),
-			makeTreeNode(node.Mid),
-			makeTreeNode(node.Rhs),
+			makeTreeNode(node.Lhs, instantiations),
+			makeTreeNode(node.Mid, instantiations),
+			makeTreeNode(node.Rhs, instantiations),
 		}
 		if node.OverloadedBy != nil {
 			children = append(children, NewDataItem("OverloadedBy", node.OverloadedBy.Decl.Name(), nil))
@@ -176,7 +189,7 @@ func makeTreeNode(node ast.Node) TreeItem {
 	case *ast.CastExpr:
 		assertNode("CastExpr.Lhs", node.Lhs)
 		children := []TreeItem{
-			makeTreeNode(node.Lhs),
+			makeTreeNode(node.Lhs, instantiations),
 		}
 		if node.OverloadedBy != nil {
 			children = append(children, NewDataItem("OverloadedBy", node.OverloadedBy.Decl.Name(), nil))
@@ -186,7 +199,7 @@ func makeTreeNode(node ast.Node) TreeItem {
 	case *ast.CastAssigneable:
 		assertNode("CastAssigneable.Lhs", node.Lhs)
 		children := []TreeItem{
-			makeTreeNode(node.Lhs),
+			makeTreeNode(node.Lhs, instantiations),
 		}
 
 		return NewNodeItem(node, node.TargetType.String(), children, "symbol-operator")
@@ -195,19 +208,19 @@ func makeTreeNode(node ast.Node) TreeItem {
 	case *ast.TypeCheck:
 		assertNode("TypeCheck.Lhs", node.Lhs)
 		return NewNodeItem(node, node.CheckType.String(), []TreeItem{
-			makeTreeNode(node.Lhs),
+			makeTreeNode(node.Lhs, instantiations),
 		}, "symbol-operator")
 
 	case *ast.Grouping:
 		assertNode("TypeCheck.Grouping", node.Expr)
 		return NewNodeItem(node, "", []TreeItem{
-			makeTreeNode(node.Expr),
+			makeTreeNode(node.Expr, instantiations),
 		}, "symbol-namespace")
 	case *ast.FuncCall:
 		args := make([]TreeItem, 0)
 		for _, v := range node.Args {
 			assertNode("FuncCall.Args.Arg", v)
-			args = append(args, makeTreeNode(v))
+			args = append(args, makeTreeNode(v, instantiations))
 		}
 
 		return NewNodeItem(node, node.Name, args, "symbol-function")
@@ -215,7 +228,7 @@ func makeTreeNode(node ast.Node) TreeItem {
 		args := make([]TreeItem, 0)
 		for _, v := range node.Args {
 			assertNode("StructLiteral.Args.Arg", v)
-			args = append(args, makeTreeNode(v))
+			args = append(args, makeTreeNode(v, instantiations))
 		}
 
 		return NewNodeItem(node, node.Struct.Name(), args, "symbol-constructor")
@@ -225,14 +238,14 @@ func makeTreeNode(node ast.Node) TreeItem {
 	case *ast.ConstDecl:
 		assertNode("ConstDecl.Val", node.Val)
 		return NewNodeItem(node, node.Name(), []TreeItem{
-			makeTreeNode(node.Val),
+			makeTreeNode(node.Val, instantiations),
 			NewDataItem("Type", node.Type.String(), nil),
 			NewDataItem("IsPublic", fmt.Sprintf("%v", node.IsPublic), nil),
 		}, "symbol-constant")
 	case *ast.VarDecl:
 		assertNode("VarDecl.InitVal", node.InitVal)
 		children := []TreeItem{
-			makeTreeNode(node.InitVal),
+			makeTreeNode(node.InitVal, instantiations),
 		}
 		if node.Type != nil {
 			children = append(children, NewDataItem("Type", node.Type.String(), nil))
@@ -274,28 +287,26 @@ func makeTreeNode(node ast.Node) TreeItem {
 		}
 
 		if node.Def != nil {
-			children = append(children, makeTreeNode(node.Def))
+			children = append(children, makeTreeNode(node.Def, instantiations))
 
 			return NewNodeItem(node, node.Name(), children, "symbol-function")
 		}
 
 		if ast.IsGeneric(node) {
-			for _, decls := range node.Generic.Instantiations {
-				for _, decl := range decls {
-					assertNode("FuncDecl.Generic.Instantiations[i]", decl)
-					children = append(children, makeTreeNode(decl))
-				}
+			for _, decl := range instantiations[node] {
+				assertNode("FuncDecl.Instantiations[i]", decl)
+				children = append(children, makeTreeNode(decl, instantiations))
 			}
 		} else {
 			assertNode("FuncDecl.Body", node.Body)
-			children = append(children, makeTreeNode(node.Body))
+			children = append(children, makeTreeNode(node.Body, instantiations))
 		}
 
 		return NewNodeItem(node, node.Name(), children, "symbol-function")
 	case *ast.FuncDef:
 		assertNode("FuncDef.Body", node.Body)
 		return NewNodeItem(node, "", []TreeItem{
-			makeTreeNode(node.Body),
+			makeTreeNode(node.Body, instantiations),
 		}, "symbol-function")
 	case *ast.StructDecl:
 		children := make([]TreeItem, 0)
@@ -303,7 +314,7 @@ func makeTreeNode(node ast.Node) TreeItem {
 		if !ast.IsGeneric(node) {
 			for _, v := range node.Fields {
 				assertNode("StructDecl.Fields.Field", v)
-				children = append(children, makeTreeNode(v))
+				children = append(children, makeTreeNode(v, instantiations))
 			}
 		}
 
@@ -336,12 +347,12 @@ func makeTreeNode(node ast.Node) TreeItem {
 		}
 
 		return NewNodeItem(node, "", []TreeItem{
-			makeTreeNode(node.Decl),
+			makeTreeNode(node.Decl, instantiations),
 		}, "symbol-class")
 	case *ast.ExprStmt:
 		assertNode("ExprStmt.Expr", node.Expr)
 		return NewNodeItem(node, "", []TreeItem{
-			makeTreeNode(node.Expr),
+			makeTreeNode(node.Expr, instantiations),
 		}, "symbol-misc")
 	case *ast.ImportStmt:
 		imports := make([]TreeItem, 0)
@@ -351,7 +362,7 @@ func makeTreeNode(node ast.Node) TreeItem {
 				case *ast.ImportStmt:
 					continue // for efficiency
 				}
-				imports = append(imports, makeTreeNode(v))
+				imports = append(imports, makeTreeNode(v, instantiations))
 			}
 		}
 
@@ -360,13 +371,13 @@ func makeTreeNode(node ast.Node) TreeItem {
 		assertNode("AssignStmt.Var", node.Var)
 		assertNode("AssignStmt.Rhs", node.Rhs)
 		return NewNodeItem(node, node.RhsType.String(), []TreeItem{
-			makeTreeNode(node.Var),
-			makeTreeNode(node.Rhs),
+			makeTreeNode(node.Var, instantiations),
+			makeTreeNode(node.Rhs, instantiations),
 		}, "symbol-value")
 	case *ast.BlockStmt:
 		children := make([]TreeItem, 0)
 		for _, v := range node.Statements {
-			children = append(children, makeTreeNode(v))
+			children = append(children, makeTreeNode(v, instantiations))
 		}
 
 		return NewNodeItem(node, "", children, "symbol-namespace")
@@ -374,11 +385,11 @@ func makeTreeNode(node ast.Node) TreeItem {
 		assertNode("IfStmt.Condition", node.Condition)
 		assertNode("IfStmt.Then", node.Then)
 		children := []TreeItem{
-			makeTreeNode(node.Condition),
-			makeTreeNode(node.Then),
+			makeTreeNode(node.Condition, instantiations),
+			makeTreeNode(node.Then, instantiations),
 		}
 		if node.Else != nil {
-			children = append(children, makeTreeNode(node.Else))
+			children = append(children, makeTreeNode(node.Else, instantiations))
 		}
 
 		return NewNodeItem(node, "", children, "repo-forked")
@@ -386,8 +397,8 @@ func makeTreeNode(node ast.Node) TreeItem {
 		assertNode("WhileStmt.Condition", node.Condition)
 		assertNode("WhileStmt.Body", node.Body)
 		return NewNodeItem(node, "", []TreeItem{
-			makeTreeNode(node.Condition),
-			makeTreeNode(node.Body),
+			makeTreeNode(node.Condition, instantiations),
+			makeTreeNode(node.Body, instantiations),
 		}, "sync")
 	case *ast.ForStmt:
 		assertNode("ForStmt.Initializer", node.Initializer)
@@ -395,22 +406,22 @@ func makeTreeNode(node ast.Node) TreeItem {
 		assertNode("ForStmt.StepSize", node.StepSize)
 		assertNode("ForStmt.Body", node.Body)
 		return NewNodeItem(node, "", []TreeItem{
-			makeTreeNode(node.Initializer),
-			makeTreeNode(node.To),
-			makeTreeNode(node.StepSize),
-			makeTreeNode(node.Body),
+			makeTreeNode(node.Initializer, instantiations),
+			makeTreeNode(node.To, instantiations),
+			makeTreeNode(node.StepSize, instantiations),
+			makeTreeNode(node.Body, instantiations),
 		}, "sync")
 	case *ast.ForRangeStmt:
 		assertNode("ForRangeStmt.Initializer", node.Initializer)
 		assertNode("ForRangeStmt.In", node.In)
 		assertNode("ForRangeStmt.Body", node.Body)
 		children := []TreeItem{
-			makeTreeNode(node.Initializer),
-			makeTreeNode(node.In),
-			makeTreeNode(node.Body),
+			makeTreeNode(node.Initializer, instantiations),
+			makeTreeNode(node.In, instantiations),
+			makeTreeNode(node.Body, instantiations),
 		}
 		if node.Index != nil {
-			children = append(children, makeTreeNode(node.Index))
+			children = append(children, makeTreeNode(node.Index, instantiations))
 		}
 
 		return NewNodeItem(node, "", children, "sync")
@@ -422,7 +433,7 @@ func makeTreeNode(node ast.Node) TreeItem {
 		}
 
 		return NewNodeItem(node, "", []TreeItem{
-			makeTreeNode(node.Value),
+			makeTreeNode(node.Value, instantiations),
 		}, "newline")
 	case *ast.TodoStmt:
 		return NewNodeItem(node, "", nil, "ellipsis")
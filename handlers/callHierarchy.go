@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/DDP-Projekt/DDPLS/documents"
+	"github.com/DDP-Projekt/DDPLS/helper"
+	"github.com/DDP-Projekt/DDPLS/uri"
+	"github.com/DDP-Projekt/Kompilierer/src/ast"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func CreateTextDocumentPrepareCallHierarchy(dm *documents.DocumentManager) protocol.TextDocumentPrepareCallHierarchyFunc {
+	return RecoverAnyErr(func(context *glsp.Context, params *protocol.CallHierarchyPrepareParams) ([]protocol.CallHierarchyItem, error) {
+		doc, ok := dm.Get(params.TextDocument.URI)
+		if !ok {
+			return nil, fmt.Errorf("%s not in document map", params.TextDocument.URI)
+		}
+
+		preparer := &callHierarchyPreparer{pos: decodePosition(dm, doc, params.Position)}
+		ast.VisitModule(doc.Module, preparer)
+		if preparer.decl == nil {
+			return nil, nil
+		}
+
+		_, uris := openModules(dm)
+		decl := genericDeclOf(preparer.decl)
+		return []protocol.CallHierarchyItem{newEncoder(dm, doc).callHierarchyItem(funcToCallHierarchyItem(decl, uris))}, nil
+	})
+}
+
+func CreateCallHierarchyIncomingCalls(dm *documents.DocumentManager) protocol.CallHierarchyIncomingCallsFunc {
+	return RecoverAnyErr(func(context *glsp.Context, params *protocol.CallHierarchyIncomingCallsParams) ([]protocol.CallHierarchyIncomingCall, error) {
+		modules, uris := workspaceModules(dm, uri.FromURI(params.Item.URI).Filepath())
+		enc := newEncoder(dm)
+		_, decl, ok := resolveCallHierarchyItem(dm, enc, params.Item, modules)
+		if !ok || decl == nil {
+			return nil, nil
+		}
+		target := keyOf(decl)
+
+		instantiations := workspaceInstantiations(dm)
+		callers := make(map[declKey]int)
+		result := make([]protocol.CallHierarchyIncomingCall, 0)
+		for _, mod := range modules {
+			forEachCaller(mod, instantiations, func(caller *ast.FuncDecl, node ast.Node) {
+				for _, call := range collectCalls(node) {
+					if keyOf(call.Func) != target {
+						continue
+					}
+
+					callerKey := declKey{file: mod.FileName}
+					if caller != nil {
+						callerKey = keyOf(caller)
+					}
+
+					i, ok := callers[callerKey]
+					if !ok {
+						i = len(result)
+						callers[callerKey] = i
+
+						item := moduleToCallHierarchyItem(mod, uris)
+						if caller != nil {
+							item = funcToCallHierarchyItem(genericDeclOf(caller), uris)
+						}
+						result = append(result, protocol.CallHierarchyIncomingCall{From: item})
+					}
+					result[i].FromRanges = appendRange(result[i].FromRanges, enc.rang(uri.FromURI(moduleUri(uris, mod)), helper.ToProtocolRange(call.Range)))
+				}
+			})
+		}
+
+		for i := range result {
+			result[i].From = enc.callHierarchyItem(result[i].From)
+		}
+		return result, nil
+	})
+}
+
+func CreateCallHierarchyOutgoingCalls(dm *documents.DocumentManager) protocol.CallHierarchyOutgoingCallsFunc {
+	return RecoverAnyErr(func(context *glsp.Context, params *protocol.CallHierarchyOutgoingCallsParams) ([]protocol.CallHierarchyOutgoingCall, error) {
+		modules, uris := workspaceModules(dm, uri.FromURI(params.Item.URI).Filepath())
+		enc := newEncoder(dm)
+		mod, decl, ok := resolveCallHierarchyItem(dm, enc, params.Item, modules)
+		if !ok {
+			return nil, nil
+		}
+
+		callees := make(map[declKey]int)
+		result := make([]protocol.CallHierarchyOutgoingCall, 0)
+		forEachCaller(mod, workspaceInstantiations(dm), func(caller *ast.FuncDecl, node ast.Node) {
+			if caller != decl {
+				return
+			}
+
+			for _, call := range collectCalls(node) {
+				callee := genericDeclOf(call.Func)
+				if callee.Module() == nil {
+					continue
+				}
+
+				i, ok := callees[keyOf(callee)]
+				if !ok {
+					i = len(result)
+					callees[keyOf(callee)] = i
+					result = append(result, protocol.CallHierarchyOutgoingCall{To: funcToCallHierarchyItem(callee, uris)})
+				}
+				result[i].FromRanges = appendRange(result[i].FromRanges, enc.rang(uri.FromURI(moduleUri(uris, mod)), helper.ToProtocolRange(call.Range)))
+			}
+		})
+
+		for i := range result {
+			result[i].To = enc.callHierarchyItem(result[i].To)
+		}
+		return result, nil
+	})
+}
+
+// finds the module and function of an item returned by CreateTextDocumentPrepareCallHierarchy
+// decl is nil if the item represents the top level statements of mod
+func resolveCallHierarchyItem(dm *documents.DocumentManager, enc *encoder, item protocol.CallHierarchyItem, modules []*ast.Module) (mod *ast.Module, decl *ast.FuncDecl, ok bool) {
+	path := uri.FromURI(item.URI).Filepath()
+	// a module that imports path might contain an older copy of it parsed from disk
+	if i := slices.IndexFunc(modules, func(m *ast.Module) bool { return m.FileName == path }); i != -1 {
+		mod = modules[i]
+	} else {
+		for _, m := range modules {
+			// the file might only be imported by an open document
+			if imprt := findModule(path, dm, m.Imports); imprt.mod != nil {
+				mod = imprt.mod
+				break
+			}
+		}
+	}
+	if mod == nil {
+		return nil, nil, false
+	}
+
+	if item.Kind == protocol.SymbolKindFile {
+		return mod, nil, true
+	}
+
+	selection := helper.FromProtocolRange(enc.decodeRange(uri.FromURI(item.URI), item.SelectionRange))
+	for _, stmt := range mod.Ast.Statements {
+		if declStmt, ok := stmt.(*ast.DeclStmt); ok {
+			if decl, ok := declStmt.Decl.(*ast.FuncDecl); ok && decl.NameTok.Range == selection {
+				return mod, decl, true
+			}
+		}
+	}
+	return nil, nil, false
+}
+
+// returns the instantiations of the generic functions in the open documents and the indexed modules
+func workspaceInstantiations(dm *documents.DocumentManager) documents.Instantiations {
+	instantiations := make(documents.Instantiations).Merge(dm.IndexedInstantiations())
+	for _, doc := range dm.GetAll() {
+		instantiations.Merge(doc.Instantiations)
+	}
+	return instantiations
+}
+
+// calls fn with every function body in mod and the function it belongs to
+// statements outside of functions are passed with a nil function
+// the bodies of generic instantiations are passed with the generic function
+func forEachCaller(mod *ast.Module, instantiations documents.Instantiations, fn func(caller *ast.FuncDecl, node ast.Node)) {
+	for _, stmt := range mod.Ast.Statements {
+		switch stmt := stmt.(type) {
+		case *ast.DeclStmt:
+			decl, isFunc := stmt.Decl.(*ast.FuncDecl)
+			if !isFunc {
+				break
+			}
+
+			if decl.Body != nil {
+				fn(decl, decl.Body)
+			}
+			for _, instantiation := range instantiations[decl] {
+				if instantiation.Body != nil {
+					fn(decl, instantiation.Body)
+				}
+			}
+			continue
+		case *ast.FuncDef:
+			fn(stmt.Func, stmt.Body)
+			continue
+		}
+
+		fn(nil, stmt)
+	}
+}
+
+// returns all function calls in node
+func collectCalls(node ast.Node) []*ast.FuncCall {
+	calls := make([]*ast.FuncCall, 0)
+	ast.VisitNode(ast.FuncCallVisitorFunc(func(call *ast.FuncCall) ast.VisitResult {
+		if call.Func != nil {
+			calls = append(calls, call)
+		}
+		return ast.VisitRecurse
+	}), node, nil)
+	return calls
+}
+
+// folds generic instantiations back to their generic declaration
+func genericDeclOf(decl *ast.FuncDecl) *ast.FuncDecl {
+	if ast.IsGenericInstantiation(decl) {
+		return decl.GenericInstantiation.GenericDecl
+	}
+	return decl
+}
+
+// appends rang to ranges if it is not already present
+// the bodies of generic instantiations share the same ranges
+func appendRange(ranges []protocol.Range, rang protocol.Range) []protocol.Range {
+	for _, r := range ranges {
+		if r == rang {
+			return ranges
+		}
+	}
+	return append(ranges, rang)
+}
+
+func funcToCallHierarchyItem(decl *ast.FuncDecl, uris map[string]uri.URI) protocol.CallHierarchyItem {
+	detail := decl.Module().GetIncludeFilename()
+	return protocol.CallHierarchyItem{
+		Name:           decl.NameTok.Literal,
+		Kind:           symbolKind(decl),
+		Detail:         &detail,
+		URI:            moduleUri(uris, decl.Module()),
+		Range:          helper.ToProtocolRange(decl.GetRange()),
+		SelectionRange: helper.ToProtocolRange(decl.NameTok.Range),
+	}
+}
+
+// represents the statements of mod that are not inside a function
+func moduleToCallHierarchyItem(mod *ast.Module, uris map[string]uri.URI) protocol.CallHierarchyItem {
+	return protocol.CallHierarchyItem{
+		Name: mod.GetIncludeFilename(),
+		Kind: protocol.SymbolKindFile,
+		URI:  moduleUri(uris, mod),
+	}
+}
+
+type callHierarchyPreparer struct {
+	pos  protocol.Position
+	decl *ast.FuncDecl
+}
+
+var (
+	_ ast.Visitor            = (*callHierarchyPreparer)(nil)
+	_ ast.ConditionalVisitor = (*callHierarchyPreparer)(nil)
+	_ ast.FuncDeclVisitor    = (*callHierarchyPreparer)(nil)
+	_ ast.FuncCallVisitor    = (*callHierarchyPreparer)(nil)
+)
+
+func (*callHierarchyPreparer) Visitor() {}
+
+func (p *callHierarchyPreparer) ShouldVisit(node ast.Node) bool {
+	return helper.IsInRange(node.GetRange(), p.pos)
+}
+
+func (p *callHierarchyPreparer) VisitFuncDecl(d *ast.FuncDecl) ast.VisitResult {
+	if helper.IsInRange(d.NameTok.Range, p.pos) {
+		p.decl = d
+		return ast.VisitBreak
+	}
+	return ast.VisitRecurse
+}
+
+// nested calls are visited later, so the innermost call wins
+func (p *callHierarchyPreparer) VisitFuncCall(e *ast.FuncCall) ast.VisitResult {
+	if e.Func != nil {
+		p.decl = e.Func
+	}
+	return ast.VisitRecurse
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DDP-Projekt/DDPLS/documents"
+	"github.com/DDP-Projekt/DDPLS/helper"
+	"github.com/DDP-Projekt/DDPLS/uri"
+	"github.com/DDP-Projekt/Kompilierer/src/ast"
+	"github.com/DDP-Projekt/Kompilierer/src/parser"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// an item of an open document is resolved against the document itself,
+// not against the older copy that a module before it imported from disk
+func TestResolveCallHierarchyItem(t *testing.T) {
+	const function = `Die öffentliche Funktion f gibt eine Zahl zurück, macht:
+	Gib 1 zurück.
+Und kann so benutzt werden:
+	"f"
+`
+	dir := t.TempDir()
+	libPath, importerPath := filepath.Join(dir, "lib.ddp"), filepath.Join(dir, "a.ddp")
+	if err := os.WriteFile(libPath, []byte(function), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(importerPath, []byte("Binde \"lib\" ein.\nDie Zahl x ist f.\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	importer, err := parser.Parse(parser.Options{FileName: importerPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the open document has unsaved changes that moved f
+	dm := documents.NewDocumentManager()
+	libUri := string(uri.FromPath(libPath))
+	if err := dm.AddAndParse(libUri, 1, "Die Zahl y ist 2.\n"+function); err != nil {
+		t.Fatal(err)
+	}
+	lib, _ := dm.Get(libUri)
+	var f *ast.FuncDecl
+	for _, stmt := range lib.Module.Ast.Statements {
+		if declStmt, ok := stmt.(*ast.DeclStmt); ok {
+			if decl, ok := declStmt.Decl.(*ast.FuncDecl); ok {
+				f = decl
+			}
+		}
+	}
+	if f == nil {
+		t.Fatal("f was not declared")
+	}
+
+	item := protocol.CallHierarchyItem{
+		Name:           f.Name(),
+		Kind:           protocol.SymbolKindFunction,
+		URI:            libUri,
+		Range:          helper.ToProtocolRange(f.GetRange()),
+		SelectionRange: helper.ToProtocolRange(f.NameTok.Range),
+	}
+	mod, decl, ok := resolveCallHierarchyItem(dm, newEncoder(dm, lib), item, []*ast.Module{importer, lib.Module})
+	if !ok || mod != lib.Module || decl != f {
+		t.Errorf("the item was not resolved against the open document")
+	}
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+
+	"github.com/DDP-Projekt/DDPLS/documents"
+	"github.com/DDP-Projekt/DDPLS/log"
+	"github.com/sourcegraph/jsonrpc2"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// the LSP error code of requests that were cancelled
+const codeRequestCancelled = -32800
+
+// returned instead of a result if the client cancelled the request or
+// the document of the request changed or was closed while the request was processed
+var errRequestCancelled = &jsonrpc2.Error{
+	Code:    codeRequestCancelled,
+	Message: "RequestCancelled: the request was cancelled or the document changed while the request was processed",
+}
+
+// returns errRequestCancelled if ctx is done and err otherwise
+func cancelledOr(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return errRequestCancelled
+	}
+	return err
+}
+
+// reports wether ctx is set and done
+// used by visitors to stop visiting once their request was cancelled
+func isCancelled(ctx context.Context) bool {
+	return ctx != nil && ctx.Err() != nil
+}
+
+// the contexts of the requests that are being processed
+// glsp does not tell handlers the id of their request,
+// so the contexts are also looked up by the glsp.Context of the request
+type runningRequests struct {
+	mu       sync.Mutex
+	cancels  map[jsonrpc2.ID]context.CancelFunc
+	contexts map[*glsp.Context]context.Context
+}
+
+var requests = runningRequests{
+	cancels:  make(map[jsonrpc2.ID]context.CancelFunc),
+	contexts: make(map[*glsp.Context]context.Context),
+}
+
+// registers the request with the given id, which is handled with glspContext
+// its context is cancelled by $/cancelRequest or when done is called after the request was handled
+func StartRequest(ctx context.Context, id jsonrpc2.ID, glspContext *glsp.Context) (done func()) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	requests.mu.Lock()
+	defer requests.mu.Unlock()
+	requests.cancels[id] = cancel
+	requests.contexts[glspContext] = ctx
+
+	return func() {
+		requests.mu.Lock()
+		defer requests.mu.Unlock()
+		delete(requests.cancels, id)
+		delete(requests.contexts, glspContext)
+		cancel()
+	}
+}
+
+// returns the context of the request that is handled with glspContext
+// notifications and unregistered requests are never cancelled
+func requestContext(glspContext *glsp.Context) context.Context {
+	requests.mu.Lock()
+	defer requests.mu.Unlock()
+	if ctx, ok := requests.contexts[glspContext]; ok {
+		return ctx
+	}
+	return context.Background()
+}
+
+// returns a context that is cancelled when the request that is handled with glspContext is cancelled
+// or when the document changes or is closed (see DocumentManager.Context),
+// which is when editors cancel requests anyway
+// stop must be called once the request was handled
+func documentRequestContext(glspContext *glsp.Context, dm *documents.DocumentManager, vscURI string) (ctx context.Context, stop func()) {
+	ctx, cancel := context.WithCancel(requestContext(glspContext))
+	stopAfter := context.AfterFunc(dm.Context(vscURI), cancel)
+	return ctx, func() {
+		stopAfter()
+		cancel()
+	}
+}
+
+func CreateCancelRequest() protocol.CancelRequestFunc {
+	return RecoverErr(func(context *glsp.Context, params *protocol.CancelParams) error {
+		var id jsonrpc2.ID
+		switch value := params.ID.Value.(type) {
+		case protocol.Integer:
+			id = jsonrpc2.ID{Num: uint64(value)}
+		case string:
+			id = jsonrpc2.ID{Str: value, IsString: true}
+		default:
+			log.Warningf("cancel request for invalid id %v", params.ID.Value)
+			return nil
+		}
+
+		requests.mu.Lock()
+		defer requests.mu.Unlock()
+		// the request might already be finished
+		if cancel, ok := requests.cancels[id]; ok {
+			cancel()
+		}
+		return nil
+	})
+}
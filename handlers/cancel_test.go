@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DDP-Projekt/DDPLS/documents"
+	"github.com/sourcegraph/jsonrpc2"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func TestCancelRequest(t *testing.T) {
+	const docUri = "file:///cancel_test.ddp"
+	dm := documents.NewDocumentManager()
+	if err := dm.AddAndParse(docUri, 1, "Die Zahl x ist 1.\nDie Zahl y ist x.\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	cancelled, other := &glsp.Context{}, &glsp.Context{}
+	doneCancelled := StartRequest(context.Background(), jsonrpc2.ID{Num: 7}, cancelled)
+	defer doneCancelled()
+	doneOther := StartRequest(context.Background(), jsonrpc2.ID{Str: "7", IsString: true}, other)
+	defer doneOther()
+
+	if err := CreateCancelRequest()(&glsp.Context{}, &protocol.CancelParams{ID: protocol.IntegerOrString{Value: protocol.Integer(7)}}); err != nil {
+		t.Fatal(err)
+	}
+	if requestContext(cancelled).Err() == nil {
+		t.Error("the request was not cancelled")
+	}
+	if requestContext(other).Err() != nil {
+		t.Error("a request with another id was cancelled")
+	}
+
+	params := &protocol.ReferenceParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: docUri},
+			Position:     protocol.Position{Line: 0, Character: 9}, // x
+		},
+	}
+	_, err := CreateTextDocumentReferences(dm)(cancelled, params)
+	var rpcErr *jsonrpc2.Error
+	if !errors.As(err, &rpcErr) || rpcErr.Code != codeRequestCancelled {
+		t.Errorf("got error %v, want code %d", err, codeRequestCancelled)
+	}
+
+	locations, err := CreateTextDocumentReferences(dm)(other, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locations) != 1 {
+		t.Errorf("got %d locations, want 1", len(locations))
+	}
+
+	doneOther()
+	if requestContext(other).Err() != nil {
+		t.Error("the context of a finished request is still registered")
+	}
+}
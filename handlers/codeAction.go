@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/DDP-Projekt/DDPLS/documents"
+	"github.com/DDP-Projekt/Kompilierer/src/ddperror"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// generates the edits that fix the given diagnostic in doc
+// every fix is returned as its own code action
+type quickFixFunc func(doc *documents.DocumentState, diagnostic protocol.Diagnostic) []quickFix
+
+// a single fix for a diagnostic
+type quickFix struct {
+	title       string
+	edits       []protocol.TextEdit
+	isPreferred bool
+}
+
+// maps error codes to their fix generators
+var quickFixes = make(map[ddperror.Code][]quickFixFunc)
+
+// registers fix to be offered for all diagnostics with the given code
+// should be called from init functions
+func registerQuickFix(code ddperror.Code, fix quickFixFunc) {
+	quickFixes[code] = append(quickFixes[code], fix)
+}
+
+func CreateTextDocumentCodeAction(dm *documents.DocumentManager) protocol.TextDocumentCodeActionFunc {
+	return RecoverAnyErr(func(context *glsp.Context, params *protocol.CodeActionParams) (any, error) {
+		doc, ok := dm.Get(params.TextDocument.URI)
+		if !ok {
+			return nil, fmt.Errorf("%s not in document map", params.TextDocument.URI)
+		}
+
+		if len(params.Context.Only) > 0 && !containsKind(params.Context.Only, protocol.CodeActionKindQuickFix) {
+			return nil, nil
+		}
+
+		enc := newEncoder(dm, doc)
+		actions := make([]protocol.CodeAction, 0, len(params.Context.Diagnostics))
+		for _, diagnostic := range params.Context.Diagnostics {
+			if diagnostic.Source == nil || *diagnostic.Source != errSrc {
+				continue
+			}
+
+			code, ok := diagnosticCode(diagnostic)
+			if !ok {
+				continue
+			}
+
+			// the quick fixes work with rune columns
+			decoded := diagnostic
+			decoded.Range = decodeRange(dm, doc, diagnostic.Range)
+			for _, fixFunc := range quickFixes[code] {
+				for _, fix := range fixFunc(doc, decoded) {
+					actions = append(actions, protocol.CodeAction{
+						Title:       fix.title,
+						Kind:        ptr(protocol.CodeActionKindQuickFix),
+						Diagnostics: []protocol.Diagnostic{diagnostic},
+						IsPreferred: ptr(fix.isPreferred),
+						Edit: &protocol.WorkspaceEdit{
+							Changes: map[protocol.DocumentUri][]protocol.TextEdit{
+								params.TextDocument.URI: enc.textEdits(doc.Uri, fix.edits),
+							},
+						},
+					})
+				}
+			}
+		}
+
+		return actions, nil
+	})
+}
+
+// extracts the ddperror.Code from a diagnostic
+// the client sends the code back as json number
+func diagnosticCode(diagnostic protocol.Diagnostic) (ddperror.Code, bool) {
+	if diagnostic.Code == nil {
+		return 0, false
+	}
+
+	switch code := diagnostic.Code.Value.(type) {
+	case ddperror.Code:
+		return code, true
+	case protocol.Integer:
+		return ddperror.Code(code), code >= 0
+	case float64:
+		return ddperror.Code(code), code >= 0
+	}
+	return 0, false
+}
+
+// reports wether kind was requested by the client
+func containsKind(kinds []protocol.CodeActionKind, kind protocol.CodeActionKind) bool {
+	for _, k := range kinds {
+		if k == kind || k == protocol.CodeActionKindEmpty {
+			return true
+		}
+	}
+	return false
+}
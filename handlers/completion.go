@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
 	"io/fs"
 	"os"
@@ -12,6 +13,7 @@ import (
 	"github.com/DDP-Projekt/DDPLS/documents"
 	"github.com/DDP-Projekt/DDPLS/helper"
 	"github.com/DDP-Projekt/DDPLS/log"
+	"github.com/DDP-Projekt/DDPLS/uri"
 	"github.com/DDP-Projekt/Kompilierer/src/ast"
 	"github.com/DDP-Projekt/Kompilierer/src/ddperror"
 	"github.com/DDP-Projekt/Kompilierer/src/ddppath"
@@ -25,19 +27,26 @@ func CreateTextDocumentCompletion(dm *documents.DocumentManager) protocol.TextDo
 		var docModule *ast.Module
 		var latestError *ddperror.Error
 		// Get the current Document
-		if d, ok := dm.Get(params.TextDocument.URI); ok {
-			docModule = d.Module
-			for _, err := range d.LatestErrors {
-				if helper.IsInRange(err.Range, params.Position) {
-					latestError = &err
-					break
-				}
+		// a newer keystroke makes the completion obsolete, so we don't wait for its parse
+		ctx, stop := documentRequestContext(context, dm, params.TextDocument.URI)
+		defer stop()
+		d, err := dm.GetWithContext(ctx, params.TextDocument.URI)
+		if err != nil {
+			return nil, cancelledOr(ctx, err)
+		}
+		docModule = d.Module
+		pos := decodePosition(dm, d, params.Position)
+		tokenPos := helper.FromProtocolPosition(pos)
+		for _, err := range d.LatestErrors {
+			if helper.IsInRange(err.Range, pos) {
+				latestError = &err
+				break
 			}
 		}
 
 		// in case of import completion we need nothing else
 		importVisitor := &importVisitor{
-			pos:               params.Position,
+			pos:               pos,
 			modPath:           docModule.FileName,
 			isSlashCompletion: params.Context.TriggerKind == protocol.CompletionTriggerKindTriggerCharacter && *params.Context.TriggerCharacter == "/",
 		}
@@ -47,18 +56,22 @@ func CreateTextDocumentCompletion(dm *documents.DocumentManager) protocol.TextDo
 		}
 
 		visitor := &tableVisitor{
+			ctx:             ctx,
 			Table:           docModule.Ast.Symbols,
 			tempTable:       docModule.Ast.Symbols,
-			pos:             params.Position,
+			pos:             pos,
 			isDotCompletion: params.Context.TriggerKind == protocol.CompletionTriggerKindTriggerCharacter && *params.Context.TriggerCharacter == ".",
 		}
 		ast.VisitModule(docModule, visitor)
+		if ctx.Err() != nil {
+			return nil, errRequestCancelled
+		}
 
 		items := make([]protocol.CompletionItem, 0, len(ddpTypes)+53)
 
 		// in case of dot completions we don't need anything else
 		if visitor.isDotCompletion {
-			items = appendDotCompletion(items, visitor.ident, params.Position)
+			items = appendDotCompletion(items, visitor.ident, pos, newEncoder(dm, d), d.Uri)
 			return items, nil
 		}
 
@@ -70,7 +83,7 @@ func CreateTextDocumentCompletion(dm *documents.DocumentManager) protocol.TextDo
 		for table != nil {
 			for name := range table.(*ast.BasicSymbolTable).Declarations {
 				decl, _, _ := table.LookupDecl(name)
-				if decl.Module() == docModule && decl.GetRange().Start.IsBehind(helper.FromProtocolPosition(params.Position)) {
+				if decl.Module() == docModule && decl.GetRange().Start.IsBehind(tokenPos) {
 					continue
 				}
 
@@ -262,7 +275,7 @@ func appendDDPTypes(items []protocol.CompletionItem) []protocol.CompletionItem {
 	return items
 }
 
-func appendDotCompletion(items []protocol.CompletionItem, ident *ast.Ident, pos protocol.Position) []protocol.CompletionItem {
+func appendDotCompletion(items []protocol.CompletionItem, ident *ast.Ident, pos protocol.Position, enc *encoder, docUri uri.URI) []protocol.CompletionItem {
 	if ident == nil || ident.Declaration == nil {
 		return items
 	}
@@ -281,13 +294,13 @@ func appendDotCompletion(items []protocol.CompletionItem, ident *ast.Ident, pos
 			SortText: ptr("0"),
 			TextEdit: protocol.TextEdit{
 				NewText: fmt.Sprintf("%s von %s", field.Name, ident.Declaration.Name()),
-				Range: protocol.Range{
+				Range: enc.rang(docUri, protocol.Range{
 					Start: helper.ToProtocolPosition(ident.GetRange().Start),
 					End: protocol.Position{
 						Line:      pos.Line,
 						Character: pos.Character,
 					},
-				},
+				}),
 			},
 			FilterText: ptr(fmt.Sprintf("%s.%s", ident.Declaration.Name(), field.Name)),
 		})
@@ -296,6 +309,7 @@ func appendDotCompletion(items []protocol.CompletionItem, ident *ast.Ident, pos
 }
 
 type tableVisitor struct {
+	ctx             context.Context
 	Table           ast.SymbolTable
 	tempTable       ast.SymbolTable
 	pos             protocol.Position
@@ -319,6 +333,10 @@ func (t *tableVisitor) SetScope(symbols ast.SymbolTable) {
 }
 
 func (t *tableVisitor) ShouldVisit(node ast.Node) bool {
+	if isCancelled(t.ctx) {
+		return false
+	}
+
 	shouldVisit := helper.IsInRange(node.GetRange(), t.pos)
 	if shouldVisit {
 		t.Table = t.tempTable
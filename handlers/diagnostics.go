@@ -3,9 +3,11 @@ package handlers
 import (
 	"context"
 	"fmt"
+	"maps"
 	"reflect"
 	"runtime/debug"
 	"slices"
+	"sync"
 	"time"
 
 	"github.com/DDP-Projekt/DDPLS/documents"
@@ -24,7 +26,6 @@ type diagnosticParams struct {
 	dm     *documents.DocumentManager
 	notify glsp.NotifyFunc
 	vscURI uri.URI
-	delay  bool
 }
 
 type modImport struct {
@@ -32,11 +33,33 @@ type modImport struct {
 	imprt *ast.ImportStmt
 }
 
-func sendDiagnostics(params *diagnosticParams) {
-	sendDiagnosticsRec(params, make(map[uri.URI]struct{}), nil, nil)
+// sends the diagnostics of all documents in batch and of the open documents that import them
+// the diagnostics of a module imported by several of them are only sent once
+func (s *DiagnosticScheduler) sendDiagnostics(batch []diagnosticParams) {
+	alreadySent := make(map[uri.URI]struct{})
+	for i := range batch {
+		s.sendDiagnosticsRec(&batch[i], alreadySent, nil, nil)
+	}
+
+	// open documents that import this document see its unsaved content
+	for _, params := range batch {
+		for _, dependent := range params.dm.Dependents(string(params.vscURI)) {
+			dependentParams := diagnosticParams{params.dm, params.notify, dependent}
+			s.sendDiagnosticsRec(&dependentParams, alreadySent, nil, nil)
+		}
+	}
+
+	// don't keep the modules of closed or outdated documents alive
+	if len(batch) > 0 {
+		for docURI, doc := range s.published {
+			if !batch[0].dm.IsLatest(doc) {
+				delete(s.published, docURI)
+			}
+		}
+	}
 }
 
-func sendDiagnosticsRec(params *diagnosticParams, alreadySent map[uri.URI]struct{}, mod *ast.Module, externalErrors []*ddperror.Error) {
+func (s *DiagnosticScheduler) sendDiagnosticsRec(params *diagnosticParams, alreadySent map[uri.URI]struct{}, mod *ast.Module, externalErrors []*ddperror.Error) {
 	if _, ok := alreadySent[params.vscURI]; ok {
 		return
 	}
@@ -50,23 +73,57 @@ func sendDiagnosticsRec(params *diagnosticParams, alreadySent map[uri.URI]struct
 	}()
 
 	var (
-		docMod = mod
-		docUri = params.vscURI
-		errs   = externalErrors
+		docMod  = mod
+		docUri  = params.vscURI
+		errs    = externalErrors
+		version *protocol.UInteger
 	)
 	if doc, ok := params.dm.Get(string(params.vscURI)); !ok && mod == nil {
 		log.Warningf("Could not retrieve for diagnostics document %s (%s)", params.vscURI)
 		return
 	} else if ok {
+		// the document changed in the meantime, so new diagnostics will be sent anyway
+		if !params.dm.IsLatest(doc) {
+			return
+		}
+		// snapshots are immutable, so their diagnostics were already sent by an earlier batch
+		if s.published[params.vscURI] == doc {
+			return
+		}
+		s.published[params.vscURI] = doc
 		docMod = doc.Module
 		docUri = doc.Uri
 		errs = toPointerSlice(doc.LatestErrors)
+		docVersion := protocol.UInteger(doc.Version)
+		version = &docVersion
+	}
+
+	diagnostics, faultyImports := moduleDiagnostics(params.dm, docUri.Filepath(), docMod, errs)
+	diagnostics = newEncoder(params.dm).diagnostics(docUri, diagnostics)
+	for path, imprt := range faultyImports {
+		params := diagnosticParams{params.dm, params.notify, uri.FromPath(path)}
+		s.sendDiagnosticsRec(&params, alreadySent, imprt.mod, imprt.errs)
 	}
 
-	path := docUri.Filepath()
+	go params.notify(protocol.ServerTextDocumentPublishDiagnostics, protocol.PublishDiagnosticsParams{
+		URI:         string(params.vscURI),
+		Version:     version,
+		Diagnostics: diagnostics,
+	})
+}
+
+// the errors of a module imported by a document
+type importErrors struct {
+	modImport
+	errs []*ddperror.Error
+}
+
+// converts errs into the diagnostics of the module at path
+// errors of imported modules are reported at their import statement
+// and returned by the path of the imported module
+func moduleDiagnostics(dm *documents.DocumentManager, path string, docMod *ast.Module, errs []*ddperror.Error) ([]protocol.Diagnostic, map[string]importErrors) {
 	diagnostics := make([]protocol.Diagnostic, 0, len(errs))
-	faultyImports := make(map[string][]*ddperror.Error, len(docMod.Imports))
-	moduleMap := make(map[string]modImport, len(docMod.Imports))
+	faultyImports := make(map[string]importErrors, len(docMod.Imports))
 
 	for _, err := range errs {
 		if err.File == path {
@@ -74,72 +131,156 @@ func sendDiagnosticsRec(params *diagnosticParams, alreadySent map[uri.URI]struct
 			continue
 		}
 
-		externalErrors := faultyImports[err.File]
-		faultyImports[err.File] = append(externalErrors, err)
-
-		if _, ok := moduleMap[err.File]; !ok {
-			imprt := findModule(err.File, params.dm, docMod.Imports)
-			if imprt.mod != nil {
-				moduleMap[err.File] = imprt
-			}
+		imprt, ok := faultyImports[err.File]
+		if !ok {
+			imprt.modImport = findModule(err.File, dm, docMod.Imports)
 		}
+		imprt.errs = append(imprt.errs, err)
+		faultyImports[err.File] = imprt
 	}
 
-	for path, errs := range faultyImports {
-		imprt := moduleMap[path]
-
-		if imprt.imprt != nil {
-			diagnostics = append(diagnostics, newImportDiagnostic(path, errs, imprt.imprt))
+	// sorted, so that the same errors always result in the same diagnostics
+	for _, path := range slices.Sorted(maps.Keys(faultyImports)) {
+		if imprt := faultyImports[path]; imprt.imprt != nil {
+			diagnostics = append(diagnostics, newImportDiagnostic(path, imprt.errs, imprt.imprt))
 		}
-
-		params := diagnosticParams{params.dm, params.notify, uri.FromPath(path), false}
-		sendDiagnosticsRec(&params, alreadySent, imprt.mod, errs)
-
-		continue
 	}
-
-	go params.notify(protocol.ServerTextDocumentPublishDiagnostics, protocol.PublishDiagnosticsParams{
-		URI:         string(params.vscURI),
-		Diagnostics: diagnostics,
-	})
+	return diagnostics, faultyImports
 }
 
-func CreateSendDiagnostics(ctx context.Context) DiagnosticSender {
-	// initialize the timer stopped
-	diagnosticsTimer := time.NewTimer(time.Nanosecond)
-	diagnosticsTimer.Stop()
+// the delay used if the client does not configure one
+const DefaultDiagnosticsDelay = 500 * time.Millisecond
+
+// schedules the diagnostics of documents
+// every document has its own debounce timer, so that editing one document
+// neither flushes nor delays the diagnostics of another
+type DiagnosticScheduler struct {
+	mu      sync.Mutex
+	delay   time.Duration
+	timers  map[uri.URI]*time.Timer      // the pending debounce timers
+	due     map[uri.URI]diagnosticParams // documents whose diagnostics are sent next
+	wake    chan struct{}                // signals that due is not empty
+	done    chan struct{}                // closed on shutdown
+	stopped chan struct{}                // closed when the worker returned
+	closed  bool
+	// the last snapshot whose diagnostics were sent per document
+	// only used by the worker
+	published map[uri.URI]*documents.DocumentState
+}
 
-	done := ctx.Done()
-	diagnosticChan := make(chan diagnosticParams)
+// creates a scheduler that runs until ctx is done or Shutdown is called
+func NewDiagnosticScheduler(ctx context.Context) *DiagnosticScheduler {
+	s := &DiagnosticScheduler{
+		delay:   DefaultDiagnosticsDelay,
+		timers:  make(map[uri.URI]*time.Timer),
+		due:     make(map[uri.URI]diagnosticParams),
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+
+		published: make(map[uri.URI]*documents.DocumentState),
+	}
 
 	go func() {
-		params := diagnosticParams{}
-	infinite_loop:
+		defer close(s.stopped)
 		for {
 			select {
-			case new_params := <-diagnosticChan:
-				if params.vscURI != new_params.vscURI && params.vscURI != "" {
-					sendDiagnostics(&params)
-				}
-
-				params = new_params
-				if params.delay {
-					diagnosticsTimer.Reset(time.Millisecond * 500)
-				} else {
-					sendDiagnostics(&params)
+			case <-s.wake:
+				s.mu.Lock()
+				batch := make([]diagnosticParams, 0, len(s.due))
+				for _, params := range s.due {
+					batch = append(batch, params)
 				}
-			case <-diagnosticsTimer.C:
-				diagnosticsTimer.Stop()
-				sendDiagnostics(&params)
-			case <-done:
-				break infinite_loop
+				clear(s.due)
+				s.mu.Unlock()
+
+				s.sendDiagnostics(batch)
+			case <-ctx.Done():
+				s.stop()
+				return
+			case <-s.done:
+				return
 			}
 		}
 	}()
 
-	return func(dm *documents.DocumentManager, notify glsp.NotifyFunc, vscURI string, delay bool) {
-		diagnosticChan <- diagnosticParams{dm, notify, uri.FromURI(vscURI), delay}
+	return s
+}
+
+// sets the delay of diagnostics after changes
+// a delay <= 0 sends them immediately
+func (s *DiagnosticScheduler) SetDelay(delay time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delay = delay
+}
+
+// schedules the diagnostics of vscURI
+// if delay is true they are sent once the document did not change for the configured delay
+func (s *DiagnosticScheduler) Schedule(dm *documents.DocumentManager, notify glsp.NotifyFunc, vscURI string, delay bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	docURI := uri.FromURI(vscURI)
+	if timer, ok := s.timers[docURI]; ok {
+		timer.Stop()
+		delete(s.timers, docURI)
+	}
+
+	params := diagnosticParams{dm, notify, docURI}
+	if !delay || s.delay <= 0 {
+		s.makeDue(params)
+		return
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(s.delay, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		// the timer was replaced by a newer one or the scheduler was shut down
+		if s.timers[docURI] != timer {
+			return
+		}
+		delete(s.timers, docURI)
+		s.makeDue(params)
+	})
+	s.timers[docURI] = timer
+}
+
+// requires s.mu
+func (s *DiagnosticScheduler) makeDue(params diagnosticParams) {
+	s.due[params.vscURI] = params
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// stops all pending timers and waits for diagnostics that are being sent
+// diagnostics scheduled afterwards are dropped
+func (s *DiagnosticScheduler) Shutdown() {
+	s.stop()
+	<-s.stopped
+}
+
+func (s *DiagnosticScheduler) stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+	s.closed = true
+	for docURI, timer := range s.timers {
+		timer.Stop()
+		delete(s.timers, docURI)
 	}
+	clear(s.due)
+	close(s.done)
 }
 
 var (
@@ -19,7 +19,7 @@ func CreateTextDocumentDocumentHighlight(dm *documents.DocumentManager) protocol
 		}
 
 		highlighter := &highlighter{
-			pos:        params.Position,
+			pos:        decodePosition(dm, act, params.Position),
 			searchMode: true,
 		}
 
@@ -28,6 +28,10 @@ func CreateTextDocumentDocumentHighlight(dm *documents.DocumentManager) protocol
 		highlighter.searchMode = false
 		ast.VisitModule(act.Module, highlighter)
 
+		enc := newEncoder(dm, act)
+		for i := range highlighter.highlightList {
+			highlighter.highlightList[i].Range = enc.rang(act.Uri, highlighter.highlightList[i].Range)
+		}
 		return highlighter.highlightList, nil
 	})
 }
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/DDP-Projekt/DDPLS/documents"
+	"github.com/DDP-Projekt/DDPLS/helper"
+	"github.com/DDP-Projekt/Kompilierer/src/ast"
+	"github.com/DDP-Projekt/Kompilierer/src/ddptypes"
+	"github.com/DDP-Projekt/Kompilierer/src/token"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func CreateTextDocumentDocumentSymbol(dm *documents.DocumentManager) protocol.TextDocumentDocumentSymbolFunc {
+	return RecoverAnyErr(func(context *glsp.Context, params *protocol.DocumentSymbolParams) (any, error) {
+		doc, ok := dm.Get(params.TextDocument.URI)
+		if !ok {
+			return nil, fmt.Errorf("document not found %s", params.TextDocument.URI)
+		}
+		docMod := doc.Module
+
+		symbols := make([]protocol.DocumentSymbol, 0, len(docMod.Ast.Statements))
+		for _, stmt := range docMod.Ast.Statements {
+			switch stmt := stmt.(type) {
+			case *ast.DeclStmt:
+				if symbol, ok := declToDocumentSymbol(stmt.Decl); ok {
+					symbols = append(symbols, symbol)
+				}
+			case *ast.ImportStmt:
+				symbols = append(symbols, importToDocumentSymbol(stmt, docMod))
+			}
+		}
+
+		return newEncoder(dm, doc).documentSymbols(doc.Uri, symbols), nil
+	})
+}
+
+// converts a top-level declaration to a DocumentSymbol
+// returns false for declarations that should not be shown
+func declToDocumentSymbol(decl ast.Declaration) (protocol.DocumentSymbol, bool) {
+	if decl.Name() == "" {
+		return protocol.DocumentSymbol{}, false
+	}
+
+	kind := symbolKind(decl)
+	switch decl := decl.(type) {
+	case *ast.VarDecl:
+		return newDocumentSymbol(decl.Name(), typeString(decl.Type), kind, decl.GetRange(), decl.NameTok.Range), true
+	case *ast.ConstDecl:
+		return newDocumentSymbol(decl.Name(), typeString(decl.Type), kind, decl.GetRange(), decl.NameTok.Range), true
+	case *ast.FuncDecl:
+		symbol := newDocumentSymbol(decl.Name(), typeString(decl.ReturnType), kind, decl.GetRange(), decl.NameTok.Range)
+		for _, param := range decl.Parameters {
+			if param.Name.Literal == "" || param.Type.Type == nil {
+				continue
+			}
+			symbol.Children = append(symbol.Children, newDocumentSymbol(param.Name.Literal, param.Type.String(), protocol.SymbolKindVariable, param.Name.Range, param.Name.Range))
+		}
+		for _, alias := range decl.Aliases {
+			symbol.Children = append(symbol.Children, aliasToDocumentSymbol(alias, protocol.SymbolKindString))
+		}
+		return symbol, true
+	case *ast.StructDecl:
+		symbol := newDocumentSymbol(decl.Name(), "", kind, decl.GetRange(), decl.NameTok.Range)
+		for _, field := range decl.Fields {
+			field, ok := field.(*ast.VarDecl)
+			if !ok || field.Name() == "" {
+				continue
+			}
+			symbol.Children = append(symbol.Children, newDocumentSymbol(field.Name(), typeString(field.Type), protocol.SymbolKindField, field.GetRange(), field.NameTok.Range))
+		}
+		for _, alias := range decl.Aliases {
+			symbol.Children = append(symbol.Children, aliasToDocumentSymbol(alias, protocol.SymbolKindConstructor))
+		}
+		return symbol, true
+	case *ast.TypeDefDecl:
+		return newDocumentSymbol(decl.Name(), typeString(decl.Underlying), kind, decl.GetRange(), decl.NameTok.Range), true
+	case *ast.TypeAliasDecl:
+		return newDocumentSymbol(decl.Name(), typeString(decl.Underlying), kind, decl.GetRange(), decl.NameTok.Range), true
+	}
+	return protocol.DocumentSymbol{}, false
+}
+
+func importToDocumentSymbol(stmt *ast.ImportStmt, docMod *ast.Module) protocol.DocumentSymbol {
+	symbol := newDocumentSymbol(ast.TrimStringLit(&stmt.FileName), "", protocol.SymbolKindModule, stmt.GetRange(), stmt.FileName.Range)
+	if symbol.Name == "" {
+		symbol.Name = stmt.FileName.Literal
+	}
+
+	for _, name := range stmt.ImportedSymbols {
+		kind := protocol.SymbolKindVariable
+		if decl, ok, _ := docMod.Ast.Symbols.LookupDecl(name.Literal); ok {
+			kind = symbolKind(decl)
+		}
+		symbol.Children = append(symbol.Children, newDocumentSymbol(name.Literal, "", kind, name.Range, name.Range))
+	}
+	return symbol
+}
+
+func aliasToDocumentSymbol(alias ast.Alias, kind protocol.SymbolKind) protocol.DocumentSymbol {
+	original := alias.GetOriginal()
+	return newDocumentSymbol(original.Literal, "", kind, original.Range, original.Range)
+}
+
+func newDocumentSymbol(name, detail string, kind protocol.SymbolKind, rang, selectionRange token.Range) protocol.DocumentSymbol {
+	symbol := protocol.DocumentSymbol{
+		Name:           name,
+		Kind:           kind,
+		Range:          helper.ToProtocolRange(rang),
+		SelectionRange: helper.ToProtocolRange(selectionRange),
+	}
+	if detail != "" {
+		symbol.Detail = &detail
+	}
+	return symbol
+}
+
+// returns the SymbolKind that fits the given declaration
+func symbolKind(decl ast.Declaration) protocol.SymbolKind {
+	switch decl := decl.(type) {
+	case *ast.ConstDecl:
+		return protocol.SymbolKindConstant
+	case *ast.FuncDecl:
+		if ast.IsOperatorOverload(decl) {
+			return protocol.SymbolKindOperator
+		}
+		return protocol.SymbolKindFunction
+	case *ast.StructDecl:
+		return protocol.SymbolKindStruct
+	case *ast.TypeDefDecl:
+		return protocol.SymbolKindClass
+	case *ast.TypeAliasDecl:
+		return protocol.SymbolKindTypeParameter
+	}
+	return protocol.SymbolKindVariable
+}
+
+// returns typ.String() or "" if typ is nil
+func typeString(typ ddptypes.Type) string {
+	if typ == nil {
+		return ""
+	}
+	return typ.String()
+}
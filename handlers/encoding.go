@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"os"
+	"slices"
+
+	"github.com/DDP-Projekt/DDPLS/documents"
+	"github.com/DDP-Projekt/DDPLS/helper"
+	"github.com/DDP-Projekt/DDPLS/uri"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// the handlers work with protocol positions whose characters count runes,
+// just like the columns of tokens (see helper.ToProtocolRange)
+// positions from the client are decoded from the negotiated position encoding
+// and positions sent to the client are encoded into it
+
+// chooses the first of the encodings preferred by the client that is supported
+// UTF-16 is used if the client did not send any
+func NegotiatePositionEncoding(clientEncodings []string) documents.PositionEncoding {
+	supported := []documents.PositionEncoding{
+		documents.PositionEncodingUTF8,
+		documents.PositionEncodingUTF16,
+		documents.PositionEncodingUTF32,
+	}
+	for _, enc := range clientEncodings {
+		if slices.Contains(supported, documents.PositionEncoding(enc)) {
+			return documents.PositionEncoding(enc)
+		}
+	}
+	return documents.PositionEncodingUTF16
+}
+
+// converts a position of doc sent by the client into rune columns
+func decodePosition(dm *documents.DocumentManager, doc *documents.DocumentState, pos protocol.Position) protocol.Position {
+	return helper.ToProtocolPosition(doc.Lines.FromProtocolPosition(pos, dm.PositionEncoding()))
+}
+
+// converts a range of doc sent by the client into rune columns
+func decodeRange(dm *documents.DocumentManager, doc *documents.DocumentState, rang protocol.Range) protocol.Range {
+	return protocol.Range{
+		Start: decodePosition(dm, doc, rang.Start),
+		End:   decodePosition(dm, doc, rang.End),
+	}
+}
+
+// converts the positions of a result from rune columns into the negotiated encoding
+// the positions might be in any file, whose line indices are only created once per encoder
+type encoder struct {
+	dm    *documents.DocumentManager
+	enc   documents.PositionEncoding
+	lines map[uri.URI]*documents.LineIndex
+}
+
+// docs are the snapshots the result was computed from
+func newEncoder(dm *documents.DocumentManager, docs ...*documents.DocumentState) *encoder {
+	e := &encoder{
+		dm:    dm,
+		enc:   dm.PositionEncoding(),
+		lines: make(map[uri.URI]*documents.LineIndex),
+	}
+	for _, doc := range docs {
+		e.lines[doc.Uri] = doc.Lines
+	}
+	return e
+}
+
+// returns the line index of the open document or file at docUri
+// or nil if the file can not be read
+func (e *encoder) linesOf(docUri uri.URI) *documents.LineIndex {
+	if lines, ok := e.lines[docUri]; ok {
+		return lines
+	}
+
+	var lines *documents.LineIndex
+	if doc, ok := e.dm.Get(string(docUri)); ok {
+		lines = doc.Lines
+	} else if content, err := os.ReadFile(docUri.Filepath()); err == nil {
+		lines = documents.NewLineIndex(string(content))
+	}
+	e.lines[docUri] = lines
+	return lines
+}
+
+func (e *encoder) position(docUri uri.URI, pos protocol.Position) protocol.Position {
+	if e.enc == documents.PositionEncodingUTF32 {
+		return pos
+	}
+	if lines := e.linesOf(docUri); lines != nil {
+		return lines.ToProtocolPosition(helper.FromProtocolPosition(pos), e.enc)
+	}
+	return pos
+}
+
+// converts a position in the file at docUri sent by the client into rune columns
+func (e *encoder) decodePosition(docUri uri.URI, pos protocol.Position) protocol.Position {
+	if e.enc == documents.PositionEncodingUTF32 {
+		return pos
+	}
+	if lines := e.linesOf(docUri); lines != nil {
+		return helper.ToProtocolPosition(lines.FromProtocolPosition(pos, e.enc))
+	}
+	return pos
+}
+
+func (e *encoder) decodeRange(docUri uri.URI, rang protocol.Range) protocol.Range {
+	return protocol.Range{
+		Start: e.decodePosition(docUri, rang.Start),
+		End:   e.decodePosition(docUri, rang.End),
+	}
+}
+
+func (e *encoder) rang(docUri uri.URI, rang protocol.Range) protocol.Range {
+	return protocol.Range{
+		Start: e.position(docUri, rang.Start),
+		End:   e.position(docUri, rang.End),
+	}
+}
+
+func (e *encoder) location(loc protocol.Location) protocol.Location {
+	loc.Range = e.rang(uri.FromURI(loc.URI), loc.Range)
+	return loc
+}
+
+func (e *encoder) locations(locs []protocol.Location) []protocol.Location {
+	for i := range locs {
+		locs[i] = e.location(locs[i])
+	}
+	return locs
+}
+
+func (e *encoder) textEdits(docUri uri.URI, edits []protocol.TextEdit) []protocol.TextEdit {
+	for i := range edits {
+		edits[i].Range = e.rang(docUri, edits[i].Range)
+	}
+	return edits
+}
+
+func (e *encoder) workspaceEdit(edit *protocol.WorkspaceEdit) *protocol.WorkspaceEdit {
+	if edit == nil {
+		return nil
+	}
+	for docUri, edits := range edit.Changes {
+		edit.Changes[docUri] = e.textEdits(uri.FromURI(docUri), edits)
+	}
+	return edit
+}
+
+func (e *encoder) documentSymbols(docUri uri.URI, symbols []protocol.DocumentSymbol) []protocol.DocumentSymbol {
+	for i := range symbols {
+		symbols[i].Range = e.rang(docUri, symbols[i].Range)
+		symbols[i].SelectionRange = e.rang(docUri, symbols[i].SelectionRange)
+		symbols[i].Children = e.documentSymbols(docUri, symbols[i].Children)
+	}
+	return symbols
+}
+
+func (e *encoder) callHierarchyItem(item protocol.CallHierarchyItem) protocol.CallHierarchyItem {
+	item.Range = e.rang(uri.FromURI(item.URI), item.Range)
+	item.SelectionRange = e.rang(uri.FromURI(item.URI), item.SelectionRange)
+	return item
+}
+
+func (e *encoder) diagnostics(docUri uri.URI, diagnostics []protocol.Diagnostic) []protocol.Diagnostic {
+	for i := range diagnostics {
+		diagnostics[i].Range = e.rang(docUri, diagnostics[i].Range)
+		for j := range diagnostics[i].RelatedInformation {
+			diagnostics[i].RelatedInformation[j].Location = e.location(diagnostics[i].RelatedInformation[j].Location)
+		}
+	}
+	return diagnostics
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/DDP-Projekt/DDPLS/documents"
+	"github.com/DDP-Projekt/DDPLS/uri"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func TestNegotiatePositionEncoding(t *testing.T) {
+	tests := []struct {
+		client []string
+		want   documents.PositionEncoding
+	}{
+		{nil, documents.PositionEncodingUTF16},
+		{[]string{}, documents.PositionEncodingUTF16},
+		{[]string{"utf-8"}, documents.PositionEncodingUTF8},
+		{[]string{"utf-32", "utf-16"}, documents.PositionEncodingUTF32},
+		{[]string{"utf-16", "utf-8"}, documents.PositionEncodingUTF16},
+		{[]string{"utf-7", "utf-8"}, documents.PositionEncodingUTF8},
+		{[]string{"latin1"}, documents.PositionEncodingUTF16},
+	}
+	for _, test := range tests {
+		if got := NegotiatePositionEncoding(test.client); got != test.want {
+			t.Errorf("NegotiatePositionEncoding(%v) = %s, want %s", test.client, got, test.want)
+		}
+	}
+}
+
+func TestEncoder(t *testing.T) {
+	const docUri = uri.URI("file:///test.ddp")
+	doc := &documents.DocumentState{
+		Uri:   docUri,
+		Lines: documents.NewLineIndex("Die Zahl ä ist 1.\r\n😀 und ß\r\n\nende"),
+	}
+
+	tests := []struct {
+		enc     documents.PositionEncoding
+		runes   protocol.Position // the position in rune columns used by the handlers
+		encoded protocol.Position // the position sent to the client
+	}{
+		{documents.PositionEncodingUTF8, protocol.Position{Line: 0, Character: 10}, protocol.Position{Line: 0, Character: 11}},
+		{documents.PositionEncodingUTF8, protocol.Position{Line: 0, Character: 17}, protocol.Position{Line: 0, Character: 18}},
+		{documents.PositionEncodingUTF8, protocol.Position{Line: 1, Character: 1}, protocol.Position{Line: 1, Character: 4}},
+		{documents.PositionEncodingUTF8, protocol.Position{Line: 1, Character: 7}, protocol.Position{Line: 1, Character: 11}},
+		{documents.PositionEncodingUTF16, protocol.Position{Line: 0, Character: 17}, protocol.Position{Line: 0, Character: 17}},
+		{documents.PositionEncodingUTF16, protocol.Position{Line: 1, Character: 1}, protocol.Position{Line: 1, Character: 2}},
+		{documents.PositionEncodingUTF16, protocol.Position{Line: 1, Character: 7}, protocol.Position{Line: 1, Character: 8}},
+		{documents.PositionEncodingUTF16, protocol.Position{Line: 3, Character: 4}, protocol.Position{Line: 3, Character: 4}},
+		{documents.PositionEncodingUTF32, protocol.Position{Line: 1, Character: 1}, protocol.Position{Line: 1, Character: 1}},
+		{documents.PositionEncodingUTF32, protocol.Position{Line: 1, Character: 7}, protocol.Position{Line: 1, Character: 7}},
+	}
+	for _, test := range tests {
+		dm := documents.NewDocumentManager()
+		dm.SetPositionEncoding(test.enc)
+		e := newEncoder(dm, doc)
+
+		if got := e.position(docUri, test.runes); got != test.encoded {
+			t.Errorf("%s: position(%v) = %v, want %v", test.enc, test.runes, got, test.encoded)
+		}
+		if got := e.decodePosition(docUri, test.encoded); got != test.runes {
+			t.Errorf("%s: decodePosition(%v) = %v, want %v", test.enc, test.encoded, got, test.runes)
+		}
+		if got := decodePosition(dm, doc, test.encoded); got != test.runes {
+			t.Errorf("%s: decodePosition(dm, %v) = %v, want %v", test.enc, test.encoded, got, test.runes)
+		}
+	}
+}
@@ -0,0 +1,457 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/DDP-Projekt/DDPLS/documents"
+	"github.com/DDP-Projekt/Kompilierer/src/ast"
+	"github.com/DDP-Projekt/Kompilierer/src/ddperror"
+	"github.com/DDP-Projekt/Kompilierer/src/parser"
+	"github.com/DDP-Projekt/Kompilierer/src/scanner"
+	"github.com/DDP-Projekt/Kompilierer/src/token"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func CreateTextDocumentFormatting(dm *documents.DocumentManager) protocol.TextDocumentFormattingFunc {
+	return RecoverAnyErr(func(context *glsp.Context, params *protocol.DocumentFormattingParams) ([]protocol.TextEdit, error) {
+		doc, ok := dm.Get(params.TextDocument.URI)
+		if !ok {
+			return nil, fmt.Errorf("%s not in document map", params.TextDocument.URI)
+		}
+
+		formatted, err := FormatSource(doc.Path, doc.Content, doc.Module, indentation(params.Options))
+		if err != nil {
+			return nil, err
+		}
+		if formatted == doc.Content {
+			return nil, nil
+		}
+
+		return []protocol.TextEdit{{
+			Range: protocol.Range{
+				Start: protocol.Position{Line: 0, Character: 0},
+				End:   doc.Lines.ProtocolPosition(len(doc.Content), dm.PositionEncoding()),
+			},
+			NewText: formatted,
+		}}, nil
+	})
+}
+
+func CreateTextDocumentRangeFormatting(dm *documents.DocumentManager) protocol.TextDocumentRangeFormattingFunc {
+	return RecoverAnyErr(func(context *glsp.Context, params *protocol.DocumentRangeFormattingParams) ([]protocol.TextEdit, error) {
+		doc, ok := dm.Get(params.TextDocument.URI)
+		if !ok {
+			return nil, fmt.Errorf("%s not in document map", params.TextDocument.URI)
+		}
+
+		f, err := newFormatter(doc.Path, doc.Content, doc.Module, indentation(params.Options))
+		if err != nil {
+			return nil, err
+		}
+
+		// a selection ending at the start of a line does not include that line
+		firstLine, lastLine := uint(params.Range.Start.Line+1), uint(params.Range.End.Line+1)
+		if params.Range.End.Character == 0 && lastLine > firstLine {
+			lastLine--
+		}
+
+		formatted, rang, ok := f.format(firstLine, lastLine)
+		if !ok {
+			return nil, nil
+		}
+
+		start, end := f.offset(rang.Start), f.offset(rang.End)
+		if formatted == doc.Content[start:end] {
+			return nil, nil
+		}
+		if !f.keepsTokens(doc.Content[:start] + formatted + doc.Content[end:]) {
+			return nil, errFormattingChangesTokens
+		}
+
+		return []protocol.TextEdit{{
+			Range:   doc.Lines.ToProtocolRange(rang, dm.PositionEncoding()),
+			NewText: formatted,
+		}}, nil
+	})
+}
+
+var errFormattingChangesTokens = errors.New("formatting would change the meaning of the source code")
+
+// returns the text of one indentation level for the given formatting options
+// the scanner counts a tab or 4 spaces as one level,
+// so spaces are only used for a tab size of 4
+func indentation(options protocol.FormattingOptions) string {
+	insertSpaces, _ := options[protocol.FormattingOptionInsertSpaces].(bool)
+	var tabSize float64
+	switch size := options[protocol.FormattingOptionTabSize].(type) {
+	case float64:
+		tabSize = size
+	case protocol.UInteger:
+		tabSize = float64(size)
+	}
+
+	if insertSpaces && tabSize == 4 {
+		return "    "
+	}
+	return "\t"
+}
+
+// formats the given ddp source code
+// mod should be the module parsed from source, if it is nil source is parsed again
+// indentation is the text of one indentation level
+func FormatSource(fileName, source string, mod *ast.Module, indentation string) (string, error) {
+	f, err := newFormatter(fileName, source, mod, indentation)
+	if err != nil {
+		return "", err
+	}
+
+	formatted, _, ok := f.format(1, math.MaxUint)
+	if !ok {
+		// nothing but whitespace
+		return source, nil
+	}
+	formatted += "\n"
+
+	if !f.keepsTokens(formatted) {
+		return "", errFormattingChangesTokens
+	}
+	return formatted, nil
+}
+
+// formats ddp source code on the token level
+// only whitespace is changed and keywords at the start of a sentence are capitalized,
+// so the resulting tokens are the same as before
+type formatter struct {
+	source      string
+	tokens      []token.Token // without EOF
+	lineStarts  []int         // byte offsets of the start of every line
+	declStarts  map[token.Position]struct{}
+	declEnds    map[uint]struct{}
+	indentation string
+	// the indentation levels computed from the ast
+	// nil if the ast has syntax errors, then the indentation of the source is kept
+	blockDepths map[uint]uint // line -> number of enclosing blocks
+	stmtStarts  map[uint]uint // line -> start line of the innermost statement containing it
+	lineIndents map[uint]uint // line -> indentation level in the source
+	// the indentation level of every token after format
+	formattedIndents []uint
+}
+
+func newFormatter(fileName, source string, mod *ast.Module, indentation string) (*formatter, error) {
+	tokens, err := scanner.Scan(scanner.Options{
+		FileName:     fileName,
+		Source:       []byte(source),
+		ScannerMode:  scanner.ModeNone,
+		ErrorHandler: ddperror.EmptyHandler,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, tok := range tokens {
+		if tok.Type == token.ILLEGAL {
+			return nil, fmt.Errorf("cannot format %s: %s", fileName, tok.Literal)
+		}
+	}
+
+	if mod == nil {
+		mod, err = parser.Parse(parser.Options{
+			FileName:     fileName,
+			Source:       []byte(source),
+			ErrorHandler: ddperror.EmptyHandler,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	f := &formatter{
+		source:           source,
+		tokens:           tokens[:len(tokens)-1],
+		lineStarts:       []int{0},
+		declStarts:       make(map[token.Position]struct{}),
+		declEnds:         make(map[uint]struct{}),
+		indentation:      indentation,
+		formattedIndents: make([]uint, len(tokens)-1),
+	}
+
+	for i, tok := range f.tokens {
+		f.formattedIndents[i] = tok.Indent
+	}
+
+	for i, r := range source {
+		if r == '\n' {
+			f.lineStarts = append(f.lineStarts, i+1)
+		}
+	}
+
+	// functions and structs are separated by blank lines
+	for _, stmt := range mod.Ast.Statements {
+		declStmt, ok := stmt.(*ast.DeclStmt)
+		if !ok {
+			continue
+		}
+
+		switch declStmt.Decl.(type) {
+		case *ast.FuncDecl, *ast.StructDecl:
+		default:
+			continue
+		}
+
+		rang := declStmt.Decl.GetRange()
+		start := rang.Start
+		// the comment has to stay directly above the declaration
+		if comment := declStmt.Decl.Comment(); comment != nil && comment.Range.Start.IsBefore(start) {
+			start = comment.Range.Start
+		}
+		f.declStarts[start] = struct{}{}
+		f.declEnds[rang.End.Line] = struct{}{}
+	}
+
+	f.collectIndents(mod)
+
+	return f, nil
+}
+
+// collects the blocks and statements of mod that determine the indentation of every line
+func (f *formatter) collectIndents(mod *ast.Module) {
+	f.blockDepths = make(map[uint]uint)
+	f.stmtStarts = make(map[uint]uint)
+	f.lineIndents = make(map[uint]uint)
+
+	for _, tok := range f.tokens {
+		if _, ok := f.lineIndents[tok.Range.Start.Line]; !ok {
+			f.lineIndents[tok.Range.Start.Line] = tok.Indent
+		}
+	}
+
+	addStmts := func(stmts []ast.Statement) {
+		for _, stmt := range stmts {
+			rang := stmt.GetRange()
+			for line := rang.Start.Line; line <= rang.End.Line; line++ {
+				// statements that start later are nested deeper
+				if start, ok := f.stmtStarts[line]; !ok || start < rang.Start.Line {
+					f.stmtStarts[line] = rang.Start.Line
+				}
+			}
+		}
+	}
+
+	addStmts(mod.Ast.Statements)
+	visitor := &indentVisitor{f: f, addStmts: addStmts}
+	ast.VisitModule(mod, visitor)
+
+	// the blocks of a module with syntax errors might be wrong
+	if visitor.bad {
+		f.blockDepths, f.stmtStarts, f.lineIndents = nil, nil, nil
+	}
+}
+
+// collects the blocks of a module for the formatter
+type indentVisitor struct {
+	f        *formatter
+	addStmts func([]ast.Statement)
+	bad      bool // wether a bad node was found
+}
+
+var (
+	_ ast.BlockStmtVisitor = (*indentVisitor)(nil)
+	_ ast.BadDeclVisitor   = (*indentVisitor)(nil)
+	_ ast.BadStmtVisitor   = (*indentVisitor)(nil)
+	_ ast.BadExprVisitor   = (*indentVisitor)(nil)
+)
+
+func (*indentVisitor) Visitor() {}
+
+func (v *indentVisitor) VisitBadDecl(*ast.BadDecl) ast.VisitResult {
+	v.bad = true
+	return ast.VisitBreak
+}
+
+func (v *indentVisitor) VisitBadStmt(*ast.BadStmt) ast.VisitResult {
+	v.bad = true
+	return ast.VisitBreak
+}
+
+func (v *indentVisitor) VisitBadExpr(*ast.BadExpr) ast.VisitResult {
+	v.bad = true
+	return ast.VisitBreak
+}
+
+func (v *indentVisitor) VisitBlockStmt(block *ast.BlockStmt) ast.VisitResult {
+	if len(block.Statements) == 0 {
+		return ast.VisitRecurse
+	}
+
+	// the lines after the colon are inside the block
+	// bodies on the same line as their statement are not indented
+	firstLine := block.Range.Start.Line + 1
+	if block.Colon.Type == token.COLON {
+		firstLine = block.Colon.Range.End.Line + 1
+	}
+	for line := firstLine; line <= block.Statements[len(block.Statements)-1].GetRange().End.Line; line++ {
+		v.f.blockDepths[line]++
+	}
+
+	v.addStmts(block.Statements)
+	return ast.VisitRecurse
+}
+
+// returns the indentation level of the line that tok starts
+// lines that continue a statement keep their indentation relative to the start of the statement
+func (f *formatter) indent(tok *token.Token) uint {
+	if f.blockDepths == nil {
+		return tok.Indent
+	}
+
+	line := tok.Range.Start.Line
+	start, ok := f.stmtStarts[line]
+	if !ok {
+		return f.blockDepths[line]
+	}
+
+	depth := f.blockDepths[start]
+	if f.lineIndents[line] > f.lineIndents[start] {
+		depth += f.lineIndents[line] - f.lineIndents[start]
+	}
+	return depth
+}
+
+// converts a token position to a byte offset into the source
+func (f *formatter) offset(pos token.Position) int {
+	if int(pos.Line) > len(f.lineStarts) {
+		return len(f.source)
+	}
+
+	offset := f.lineStarts[pos.Line-1]
+	for col := uint(1); col < pos.Column && offset < len(f.source); col++ {
+		_, size := utf8.DecodeRuneInString(f.source[offset:])
+		offset += size
+	}
+	return offset
+}
+
+// formats all tokens that start on a line in [firstLine, lastLine]
+// returns the formatted text and the range of the source it replaces
+// ok is false if there is nothing to format
+func (f *formatter) format(firstLine, lastLine uint) (formatted string, rang token.Range, ok bool) {
+	builder := strings.Builder{}
+	var prev *token.Token
+	sentenceEnded := false
+	var indent uint
+	writeIndent := func(tok *token.Token) {
+		indent = f.indent(tok)
+		builder.WriteString(strings.Repeat(f.indentation, int(indent)))
+	}
+
+	for i := range f.tokens {
+		tok := &f.tokens[i]
+		if tok.Range.Start.Line > lastLine {
+			break
+		}
+
+		if prev == nil {
+			// only start at the beginning of a line that is not part of a multi-line token
+			if tok.Range.Start.Line < firstLine || (i > 0 && f.tokens[i-1].Range.End.Line == tok.Range.Start.Line) {
+				continue
+			}
+
+			rang.Start = token.Position{Line: tok.Range.Start.Line, Column: 1}
+			writeIndent(tok)
+		} else if tok.Range.Start.Line > prev.Range.End.Line {
+			builder.WriteString(strings.Repeat("\n", 1+f.blankLines(prev, tok)))
+			writeIndent(tok)
+		} else if sentenceEnded && tok.Type != token.COMMENT {
+			// one statement per line
+			builder.WriteString("\n")
+			if _, isDeclStart := f.declStarts[tok.Range.Start]; isDeclStart {
+				builder.WriteString("\n")
+			}
+			builder.WriteString(strings.Repeat(f.indentation, int(indent)))
+		} else if needsSpace(prev, tok) {
+			builder.WriteString(" ")
+		}
+
+		literal := f.source[f.offset(tok.Range.Start):f.offset(tok.Range.End)]
+		if tok.Type != token.IDENTIFIER && decideCapitalization(f.offset(tok.Range.Start)+1, f.source) {
+			if r, size := utf8.DecodeRuneInString(literal); unicode.IsLower(r) {
+				literal = string(unicode.ToUpper(r)) + literal[size:]
+			}
+		}
+		builder.WriteString(literal)
+		f.formattedIndents[i] = indent
+
+		if tok.Type != token.COMMENT {
+			sentenceEnded = tok.Type == token.DOT
+		}
+		prev = tok
+	}
+
+	if prev == nil {
+		return "", rang, false
+	}
+
+	rang.End = prev.Range.End
+	return builder.String(), rang, true
+}
+
+// returns how many blank lines should be between prev and tok
+func (f *formatter) blankLines(prev, tok *token.Token) int {
+	_, isDeclStart := f.declStarts[tok.Range.Start]
+	_, isDeclEnd := f.declEnds[prev.Range.End.Line]
+	if isDeclStart || isDeclEnd {
+		return 1
+	}
+
+	return min(int(tok.Range.Start.Line-prev.Range.End.Line-1), 1)
+}
+
+// reports wether a space should be written between prev and tok on the same line
+func needsSpace(prev, tok *token.Token) bool {
+	// tokens that were not separated must stay that way
+	if prev.Range.End == tok.Range.Start {
+		return false
+	}
+
+	switch tok.Type {
+	case token.DOT:
+		return prev.Type == token.DOT || prev.Type == token.ELIPSIS
+	case token.COMMA:
+		return prev.Type == token.INT
+	case token.RPAREN:
+		return false
+	}
+	return prev.Type != token.LPAREN
+}
+
+// reports wether formatted scans to the same tokens as the source of f
+// with the indentation computed by format
+// keywords may differ in capitalization
+func (f *formatter) keepsTokens(formatted string) bool {
+	tokens, err := scanner.Scan(scanner.Options{
+		FileName:     "formatted",
+		Source:       []byte(formatted),
+		ScannerMode:  scanner.ModeNone,
+		ErrorHandler: ddperror.EmptyHandler,
+	})
+	if err != nil || len(tokens)-1 != len(f.tokens) {
+		return false
+	}
+
+	for i, tok := range f.tokens {
+		other := tokens[i]
+		if tok.Type != other.Type || f.formattedIndents[i] != other.Indent {
+			return false
+		}
+		if tok.Literal != other.Literal && (tok.Type == token.IDENTIFIER || !strings.EqualFold(tok.Literal, other.Literal)) {
+			return false
+		}
+	}
+	return true
+}
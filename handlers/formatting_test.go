@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"testing"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func TestFormatSource(t *testing.T) {
+	tests := []struct {
+		source, indentation, want string
+	}{
+		// the indentation comes from the blocks
+		{"Die Zahl x ist 0.\nWenn wahr, dann:\n\t\tx ist 1.\n", "\t", "Die Zahl x ist 0.\nWenn wahr, dann:\n\tx ist 1.\n"},
+		{"Die Zahl x ist 0.\nWenn wahr, dann:\n\tx ist 1.\n", "    ", "Die Zahl x ist 0.\nWenn wahr, dann:\n    x ist 1.\n"},
+		{
+			"Die Funktion f mit dem Parameter a vom Typ Zahl, gibt eine Zahl zurück, macht:\n\t\tWenn a gleich 1 ist, dann:\n\t\t\t\tGib 1 zurück.\n\t\tSonst:\n\t\t\t\tGib 2 zurück.\nUnd kann so benutzt werden:\n\t\"f von <a>\"\n",
+			"\t",
+			"Die Funktion f mit dem Parameter a vom Typ Zahl, gibt eine Zahl zurück, macht:\n\tWenn a gleich 1 ist, dann:\n\t\tGib 1 zurück.\n\tSonst:\n\t\tGib 2 zurück.\nUnd kann so benutzt werden:\n\t\"f von <a>\"\n",
+		},
+		// continuation lines keep their relative indentation
+		{
+			"Wir nennen die Kombination aus\n\tder Zahl x mit Standardwert 1,\n\tdem Text y mit Standardwert \"\",\neinen Punkt, und erstellen sie so:\n\t\"P\"\n",
+			"\t",
+			"Wir nennen die Kombination aus\n\tder Zahl x mit Standardwert 1,\n\tdem Text y mit Standardwert \"\",\neinen Punkt, und erstellen sie so:\n\t\"P\"\n",
+		},
+		// one statement per line
+		{"Die Zahl x ist 0.\nWenn wahr, dann:\n\t[Kommentar]\n\tx ist 1. x ist 2.\n[Ende]\n", "\t", "Die Zahl x ist 0.\nWenn wahr, dann:\n\t[Kommentar]\n\tx ist 1.\n\tx ist 2.\n[Ende]\n"},
+		// syntax errors keep the indentation of the source
+		{"Die Zahl x ist 0.\nWenn wahr, dann:\n\t\tx ist.\n", "\t", "Die Zahl x ist 0.\nWenn wahr, dann:\n\t\tx ist.\n"},
+		// nothing to format
+		{"", "\t", ""},
+		{"  \n\n", "\t", "  \n\n"},
+	}
+	for _, test := range tests {
+		got, err := FormatSource("test.ddp", test.source, nil, test.indentation)
+		if err != nil {
+			t.Errorf("%q: %s", test.source, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%q:\ngot  %q\nwant %q", test.source, got, test.want)
+		}
+	}
+}
+
+func TestIndentation(t *testing.T) {
+	tests := []struct {
+		options protocol.FormattingOptions
+		want    string
+	}{
+		{protocol.FormattingOptions{}, "\t"},
+		{protocol.FormattingOptions{protocol.FormattingOptionTabSize: float64(4), protocol.FormattingOptionInsertSpaces: false}, "\t"},
+		{protocol.FormattingOptions{protocol.FormattingOptionTabSize: float64(4), protocol.FormattingOptionInsertSpaces: true}, "    "},
+		{protocol.FormattingOptions{protocol.FormattingOptionTabSize: float64(2), protocol.FormattingOptionInsertSpaces: true}, "\t"},
+	}
+	for _, test := range tests {
+		if got := indentation(test.options); got != test.want {
+			t.Errorf("%v: got %q, want %q", test.options, got, test.want)
+		}
+	}
+}
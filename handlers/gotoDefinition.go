@@ -15,22 +15,26 @@ import (
 
 func CreateTextDocumentDefinition(dm *documents.DocumentManager) protocol.TextDocumentDefinitionFunc {
 	return RecoverAnyErr(func(context *glsp.Context, params *protocol.DefinitionParams) (any, error) {
+		doc, ok := dm.Get(params.TextDocument.URI)
+		if !ok {
+			return nil, fmt.Errorf("document not found %s", params.TextDocument.URI)
+		}
+
 		definition := &definitionVisitor{
 			location: nil,
-			pos:      params.Position,
+			pos:      decodePosition(dm, doc, params.Position),
 			dm:       dm,
-		}
-
-		if doc, ok := dm.Get(params.TextDocument.URI); !ok {
-			return nil, fmt.Errorf("document not found %s", params.TextDocument.URI)
-		} else {
-			definition.docMod = doc.Module
-			definition.docUri = doc.Uri
+			docMod:   doc.Module,
+			docUri:   doc.Uri,
 		}
 
 		ast.VisitModuleRec(definition.docMod, definition)
 
-		return definition.location, nil
+		if definition.location == nil {
+			return nil, nil
+		}
+		location := newEncoder(dm, doc).location(*definition.location)
+		return &location, nil
 	})
 }
 
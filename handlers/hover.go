@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -19,22 +20,33 @@ import (
 
 func CreateTextDocumentHover(dm *documents.DocumentManager) protocol.TextDocumentHoverFunc {
 	return RecoverAnyErr(func(context *glsp.Context, params *protocol.HoverParams) (*protocol.Hover, error) {
-		doc, ok := dm.Get(params.TextDocument.URI)
-		if !ok {
-			return nil, fmt.Errorf("%s not in document map", params.TextDocument.URI)
+		ctx, stop := documentRequestContext(context, dm, params.TextDocument.URI)
+		defer stop()
+		doc, err := dm.GetWithContext(ctx, params.TextDocument.URI)
+		if err != nil {
+			return nil, cancelledOr(ctx, err)
 		}
 
+		pos := decodePosition(dm, doc, params.Position)
 		hover := &hoverVisitor{
+			ctx:            ctx,
 			hover:          nil,
-			pos:            params.Position,
+			pos:            pos,
 			dm:             dm,
 			file:           doc.Module.FileName,
 			currentSymbols: doc.Module.Ast.Symbols,
-			docContent:     doc.Content,
+			docLines:       doc.Lines,
+			instantiations: doc.Instantiations,
 		}
 
 		ast.VisitModule(doc.Module, hover)
 
+		if ctx.Err() != nil {
+			return nil, errRequestCancelled
+		}
+		if hover.hover != nil && hover.hover.Range != nil {
+			*hover.hover.Range = newEncoder(dm, doc).rang(doc.Uri, *hover.hover.Range)
+		}
 		return hover.hover, nil
 	})
 }
@@ -49,10 +61,12 @@ func trimComment(comment *token.Token) string {
 }
 
 type hoverVisitor struct {
+	ctx            context.Context
 	hover          *protocol.Hover
 	pos            protocol.Position
 	currentSymbols ast.SymbolTable
-	docContent     string
+	docLines       *documents.LineIndex
+	instantiations documents.Instantiations
 	file           string
 	dm             *documents.DocumentManager
 	vis            ast.FullVisitor
@@ -72,7 +86,7 @@ var (
 func (*hoverVisitor) Visitor() {}
 
 func (h *hoverVisitor) ShouldVisit(node ast.Node) bool {
-	return helper.IsInRange(node.GetRange(), h.pos)
+	return !isCancelled(h.ctx) && helper.IsInRange(node.GetRange(), h.pos)
 }
 
 func (h *hoverVisitor) SetVisitor(vis ast.FullVisitor) {
@@ -104,7 +118,7 @@ func (h *hoverVisitor) VisitFuncDecl(d *ast.FuncDecl) ast.VisitResult {
 		}
 	}
 
-	if instantiation := getRandomGenericInstantiation(d); instantiation != nil {
+	if instantiation := getRandomGenericInstantiation(h.instantiations, d); instantiation != nil {
 		h.vis.VisitFuncDecl(instantiation)
 		return ast.VisitSkipChildren
 	}
@@ -204,11 +218,11 @@ func (h *hoverVisitor) VisitFuncCall(e *ast.FuncCall) ast.VisitResult {
 
 	// for extern functions we display the whole function,
 	// for normal functions only the first line until the colon
-	var declRange protocol.Range
+	var declRange token.Range
 	if e.Func.Body != nil {
-		declRange = helper.ToProtocolRange(token.NewRange(&e.Func.Tok, &e.Func.Body.Colon))
+		declRange = token.NewRange(&e.Func.Tok, &e.Func.Body.Colon)
 	} else {
-		declRange = helper.ToProtocolRange(e.Func.GetRange())
+		declRange = e.Func.GetRange()
 	}
 
 	genericMod := e.Func.Mod
@@ -216,7 +230,7 @@ func (h *hoverVisitor) VisitFuncCall(e *ast.FuncCall) ast.VisitResult {
 		genericMod = e.Func.GenericInstantiation.GenericDecl.Mod
 	}
 
-	moduleContent, is_same_module := h.getDifferentModContent(genericMod)
+	moduleLines, is_same_module := h.getDifferentModContent(genericMod)
 
 	// if the function is in another module, we display the path to that module
 	header := ""
@@ -232,16 +246,13 @@ func (h *hoverVisitor) VisitFuncCall(e *ast.FuncCall) ast.VisitResult {
 		header = header[:len(header)-2]
 	}
 
-	start, end := declRange.IndexesIn(moduleContent)
-	body := moduleContent[start:end]
+	body := moduleLines.Slice(declRange)
 	if e.Func.Body != nil {
 		body += "\n..."
-		endRange := helper.ToProtocolRange(token.Range{
+		body += moduleLines.Slice(token.Range{
 			Start: e.Func.Body.Range.End,
 			End:   e.Func.GetRange().End,
 		})
-		start, end = endRange.IndexesIn(moduleContent)
-		body += moduleContent[start:end]
 	}
 
 	comment := getCommentDisplayString(e.Func.Comment())
@@ -271,16 +282,14 @@ func (h *hoverVisitor) VisitStructLiteral(e *ast.StructLiteral) ast.VisitResult
 		return ast.VisitBreak
 	}
 
-	moduleContent, is_same_module := h.getDifferentModContent(e.Struct.Mod)
+	moduleLines, is_same_module := h.getDifferentModContent(e.Struct.Mod)
 
 	header := ""
 	if !is_same_module {
 		header = h.getHoverFilePath(e.Struct.Mod.FileName) + "\n"
 	}
 
-	declRange := helper.ToProtocolRange(e.Struct.GetRange())
-	start, end := declRange.IndexesIn(moduleContent)
-	body := moduleContent[start:end]
+	body := moduleLines.Slice(e.Struct.GetRange())
 
 	comment := getCommentDisplayString(e.Struct.Comment())
 	pRange := helper.ToProtocolRange(e.GetRange())
@@ -353,20 +362,20 @@ func (h *hoverVisitor) VisitImportStmt(stmt *ast.ImportStmt) ast.VisitResult {
 	return ast.VisitBreak
 }
 
-func (h *hoverVisitor) getDifferentModContent(mod *ast.Module) (string, bool) {
+func (h *hoverVisitor) getDifferentModContent(mod *ast.Module) (*documents.LineIndex, bool) {
 	is_same_module := mod.FileName == h.file
 	// retreive the content of the file in which the function is defined
-	moduleContent := h.docContent
+	moduleLines := h.docLines
 	if doc, ok := h.dm.GetFromMod(mod); !is_same_module && ok { // if we already read the file, reuse it
-		moduleContent = doc.Content
+		moduleLines = doc.Lines
 	} else if !is_same_module { // read the new file
 		if content, err := os.ReadFile(mod.FileName); err != nil {
 			log.Errorf("Unable to read %s: %s", mod.FileName, err)
 		} else {
-			moduleContent = string(content)
+			moduleLines = documents.NewLineIndex(string(content))
 		}
 	}
-	return moduleContent, is_same_module
+	return moduleLines, is_same_module
 }
 
 // helper to get a nice-looking path to display in a hover
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"fmt"
+	"reflect"
+	"runtime/debug"
+
+	"github.com/DDP-Projekt/DDPLS/documents"
+	"github.com/DDP-Projekt/DDPLS/log"
+	"github.com/DDP-Projekt/DDPLS/uri"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// the token of the progress reported while indexing the workspace
+var indexProgressToken = protocol.ProgressToken{Value: "ddpls/index"}
+
+// indexes the workspace in the background
+// if withProgress is true, the progress is reported to the client
+// which must support window/workDoneProgress/create
+// indexed is called once the workspace is indexed and may be nil
+func IndexWorkspace(context *glsp.Context, dm *documents.DocumentManager, withProgress bool, indexed func()) {
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				log.Errorf("panic of type %s while indexing the workspace: %v", reflect.TypeOf(err), err)
+				log.Errorf("stack trace: %s", string(debug.Stack()))
+			}
+		}()
+		if indexed != nil {
+			defer indexed()
+		}
+
+		if !withProgress {
+			dm.IndexWorkspace(nil)
+			return
+		}
+
+		context.Call(protocol.ServerWindowWorkDoneProgressCreate, protocol.WorkDoneProgressCreateParams{Token: indexProgressToken}, nil)
+
+		percentage := protocol.UInteger(0)
+		context.Notify(protocol.ServerProgress, protocol.ProgressParams{
+			Token: indexProgressToken,
+			Value: protocol.WorkDoneProgressBegin{
+				Kind:       "begin",
+				Title:      "Indexiere Workspace",
+				Percentage: &percentage,
+			},
+		})
+
+		dm.IndexWorkspace(func(done, total int) {
+			// only report when the percentage changes to not flood the client
+			newPercentage := protocol.UInteger(done * 100 / total)
+			if newPercentage == percentage && done != total {
+				return
+			}
+			percentage = newPercentage
+
+			message := fmt.Sprintf("%d/%d Dateien", done, total)
+			context.Notify(protocol.ServerProgress, protocol.ProgressParams{
+				Token: indexProgressToken,
+				Value: protocol.WorkDoneProgressReport{
+					Kind:       "report",
+					Message:    &message,
+					Percentage: &newPercentage,
+				},
+			})
+		})
+
+		context.Notify(protocol.ServerProgress, protocol.ProgressParams{
+			Token: indexProgressToken,
+			Value: protocol.WorkDoneProgressEnd{Kind: "end"},
+		})
+	}()
+}
+
+// indexes the files at paths in the background
+// indexed is called once they are indexed and may be nil
+func IndexFiles(dm *documents.DocumentManager, paths []string, indexed func()) {
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				log.Errorf("panic of type %s while indexing %v: %v", reflect.TypeOf(err), paths, err)
+				log.Errorf("stack trace: %s", string(debug.Stack()))
+			}
+		}()
+		if indexed != nil {
+			defer indexed()
+		}
+
+		dm.IndexFiles(paths)
+	}()
+}
+
+// the id of the registration of workspace/didChangeWatchedFiles
+const watchedFilesRegistrationID = "ddpls/watchedFiles"
+
+// asks the client to send workspace/didChangeWatchedFiles for all .ddp files
+// the client must support the dynamic registration of workspace/didChangeWatchedFiles
+func RegisterWatchedFiles(context *glsp.Context) {
+	// the client answers the request only after the handler of the current notification returned
+	go context.Call(protocol.ServerClientRegisterCapability, protocol.RegistrationParams{
+		Registrations: []protocol.Registration{{
+			ID:     watchedFilesRegistrationID,
+			Method: protocol.MethodWorkspaceDidChangeWatchedFiles,
+			RegisterOptions: protocol.DidChangeWatchedFilesRegistrationOptions{
+				Watchers: []protocol.FileSystemWatcher{{GlobPattern: "**/*.ddp"}},
+			},
+		}},
+	}, nil)
+}
+
+func CreateTextDocumentDidSave(dm *documents.DocumentManager, indexed func()) protocol.TextDocumentDidSaveFunc {
+	return RecoverErr(func(context *glsp.Context, params *protocol.DidSaveTextDocumentParams) error {
+		IndexFiles(dm, []string{uri.FromURI(params.TextDocument.URI).Filepath()}, indexed)
+		return nil
+	})
+}
+
+func CreateWorkspaceDidChangeWatchedFiles(dm *documents.DocumentManager, indexed func()) protocol.WorkspaceDidChangeWatchedFilesFunc {
+	return RecoverErr(func(context *glsp.Context, params *protocol.DidChangeWatchedFilesParams) error {
+		paths := make([]string, 0, len(params.Changes))
+		for _, change := range params.Changes {
+			paths = append(paths, uri.FromURI(change.URI).Filepath())
+		}
+		IndexFiles(dm, paths, indexed)
+		return nil
+	})
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/DDP-Projekt/DDPLS/documents"
+	"github.com/DDP-Projekt/DDPLS/helper"
+	"github.com/DDP-Projekt/Kompilierer/src/ast"
+	"github.com/DDP-Projekt/Kompilierer/src/token"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// inlay hints were added in LSP 3.17, so they are not part of protocol_3_16
+
+type InlayHintKind protocol.UInteger
+
+const (
+	InlayHintKindType      InlayHintKind = 1
+	InlayHintKindParameter InlayHintKind = 2
+)
+
+type InlayHintParams struct {
+	TextDocument protocol.TextDocumentIdentifier `json:"textDocument"`
+	Range        protocol.Range                  `json:"range"`
+}
+
+type InlayHint struct {
+	Position     protocol.Position `json:"position"`
+	Label        string            `json:"label"`
+	Kind         InlayHintKind     `json:"kind,omitempty"`
+	Tooltip      string            `json:"tooltip,omitempty"`
+	PaddingLeft  bool              `json:"paddingLeft,omitempty"`
+	PaddingRight bool              `json:"paddingRight,omitempty"`
+}
+
+// configures which kinds of inlay hints are sent
+type InlayHintOptions struct {
+	ParameterNames bool `json:"parameterNames"` // the parameter name before every argument of a function call
+	Types          bool `json:"types"`          // the instantiated types of generic function calls
+}
+
+// all kinds of inlay hints are sent unless the client disables them
+func NewInlayHintOptions() *InlayHintOptions {
+	return &InlayHintOptions{
+		ParameterNames: true,
+		Types:          true,
+	}
+}
+
+// options is set according to the initializationOptions of the client
+func CreateInlayHintRequestHandler(dm *documents.DocumentManager, options *InlayHintOptions) protocol.CustomRequestFunc {
+	return RecoverAnyErr(func(context *glsp.Context, params json.RawMessage) (any, error) {
+		var req InlayHintParams
+		if err := json.Unmarshal(params, &req); err != nil {
+			return nil, err
+		}
+
+		doc, ok := dm.Get(req.TextDocument.URI)
+		if !ok {
+			return nil, fmt.Errorf("%s not in document map", req.TextDocument.URI)
+		}
+
+		visitor := &inlayHintVisitor{
+			rang:    helper.FromProtocolRange(decodeRange(dm, doc, req.Range)),
+			options: *options,
+			hints:   make([]InlayHint, 0, 16),
+		}
+		ast.VisitModule(doc.Module, visitor)
+
+		// the hints would be placed at the wrong positions
+		if !dm.IsLatest(doc) {
+			return nil, nil
+		}
+
+		enc := newEncoder(dm, doc)
+		for i := range visitor.hints {
+			visitor.hints[i].Position = enc.position(doc.Uri, visitor.hints[i].Position)
+		}
+		return visitor.hints, nil
+	})
+}
+
+type inlayHintVisitor struct {
+	rang    token.Range
+	options InlayHintOptions
+	hints   []InlayHint
+}
+
+var (
+	_ ast.Visitor            = (*inlayHintVisitor)(nil)
+	_ ast.ConditionalVisitor = (*inlayHintVisitor)(nil)
+	_ ast.FuncCallVisitor    = (*inlayHintVisitor)(nil)
+)
+
+func (*inlayHintVisitor) Visitor() {}
+
+func (v *inlayHintVisitor) ShouldVisit(node ast.Node) bool {
+	rang := node.GetRange()
+	return !rang.End.IsBefore(v.rang.Start) && !rang.Start.IsBehind(v.rang.End)
+}
+
+func (v *inlayHintVisitor) VisitFuncCall(call *ast.FuncCall) ast.VisitResult {
+	if call.Func == nil {
+		return ast.VisitRecurse
+	}
+
+	if v.options.ParameterNames {
+		for _, param := range call.Func.Parameters {
+			arg, ok := call.Args[param.Name.Literal]
+			if !ok || arg == nil {
+				continue
+			}
+
+			// the hint would only repeat the name
+			if ident, isIdent := arg.(*ast.Ident); isIdent && ident.Literal.Literal == param.Name.Literal {
+				continue
+			}
+
+			v.hints = append(v.hints, InlayHint{
+				Position:     helper.ToProtocolPosition(arg.GetRange().Start),
+				Label:        param.Name.Literal + ":",
+				Kind:         InlayHintKindParameter,
+				Tooltip:      param.Type.String(),
+				PaddingRight: true,
+			})
+		}
+	}
+
+	if v.options.Types && ast.IsGenericInstantiation(call.Func) && len(call.Func.GenericInstantiation.Types) > 0 {
+		names := make([]string, 0, len(call.Func.GenericInstantiation.Types))
+		for name := range call.Func.GenericInstantiation.Types {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		types := make([]string, 0, len(names))
+		for _, name := range names {
+			types = append(types, fmt.Sprintf("%s = %s", name, call.Func.GenericInstantiation.Types[name]))
+		}
+
+		v.hints = append(v.hints, InlayHint{
+			Position:    helper.ToProtocolPosition(call.Range.End),
+			Label:       fmt.Sprintf("(%s)", strings.Join(types, ", ")),
+			Kind:        InlayHintKindType,
+			PaddingLeft: true,
+		})
+	}
+
+	return ast.VisitRecurse
+}
@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/DDP-Projekt/DDPLS/documents"
+	"github.com/DDP-Projekt/DDPLS/uri"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// pull diagnostics were added in LSP 3.17, so they are not part of protocol_3_16
+
+const ServerWorkspaceDiagnosticRefresh = protocol.Method("workspace/diagnostic/refresh")
+
+type DiagnosticOptions struct {
+	InterFileDependencies bool `json:"interFileDependencies"`
+	WorkspaceDiagnostics  bool `json:"workspaceDiagnostics"`
+}
+
+type DocumentDiagnosticParams struct {
+	TextDocument     protocol.TextDocumentIdentifier `json:"textDocument"`
+	PreviousResultId *string                         `json:"previousResultId,omitempty"`
+}
+
+type DocumentDiagnosticReportKind string
+
+const (
+	DocumentDiagnosticReportKindFull      DocumentDiagnosticReportKind = "full"
+	DocumentDiagnosticReportKindUnchanged DocumentDiagnosticReportKind = "unchanged"
+)
+
+type FullDocumentDiagnosticReport struct {
+	Kind     DocumentDiagnosticReportKind `json:"kind"`
+	ResultId string                       `json:"resultId"`
+	Items    []protocol.Diagnostic        `json:"items"`
+	// the reports of imported modules with errors, only set for textDocument/diagnostic
+	RelatedDocuments map[protocol.DocumentUri]any `json:"relatedDocuments,omitempty"`
+}
+
+type UnchangedDocumentDiagnosticReport struct {
+	Kind     DocumentDiagnosticReportKind `json:"kind"`
+	ResultId string                       `json:"resultId"`
+}
+
+type PreviousResultId struct {
+	URI   protocol.DocumentUri `json:"uri"`
+	Value string               `json:"value"`
+}
+
+type WorkspaceDiagnosticParams struct {
+	PreviousResultIds []PreviousResultId `json:"previousResultIds"`
+}
+
+type WorkspaceDiagnosticReport struct {
+	Items []any `json:"items"`
+}
+
+type WorkspaceFullDocumentDiagnosticReport struct {
+	FullDocumentDiagnosticReport
+	URI     protocol.DocumentUri `json:"uri"`
+	Version *int32               `json:"version"` // nil for files that are not open
+}
+
+type WorkspaceUnchangedDocumentDiagnosticReport struct {
+	UnchangedDocumentDiagnosticReport
+	URI     protocol.DocumentUri `json:"uri"`
+	Version *int32               `json:"version"` // nil for files that are not open
+}
+
+func CreateDocumentDiagnosticRequestHandler(dm *documents.DocumentManager) protocol.CustomRequestFunc {
+	return RecoverAnyErr(func(context *glsp.Context, params json.RawMessage) (any, error) {
+		var req DocumentDiagnosticParams
+		if err := json.Unmarshal(params, &req); err != nil {
+			return nil, err
+		}
+
+		docURI := uri.FromURI(req.TextDocument.URI)
+		previousResultId := ""
+		if req.PreviousResultId != nil {
+			previousResultId = *req.PreviousResultId
+		}
+
+		// for files that are not open we report the errors of the indexed file
+		if !dm.IsOpen(req.TextDocument.URI) {
+			summary, ok := dm.IndexedSummary(docURI.Filepath())
+			if !ok {
+				return newDocumentDiagnosticReport(previousResultId, nil, nil), nil
+			}
+			diagnostics := newEncoder(dm).diagnostics(docURI, summaryDiagnostics(summary))
+			return newDocumentDiagnosticReport(previousResultId, diagnostics, nil), nil
+		}
+
+		ctx, stop := documentRequestContext(context, dm, req.TextDocument.URI)
+		defer stop()
+		doc, err := dm.GetWithContext(ctx, req.TextDocument.URI)
+		if err != nil {
+			return nil, cancelledOr(ctx, err)
+		}
+
+		enc := newEncoder(dm, doc)
+		diagnostics, faultyImports := moduleDiagnostics(dm, doc.Path, doc.Module, toPointerSlice(doc.LatestErrors))
+		diagnostics = enc.diagnostics(doc.Uri, diagnostics)
+		related := make(map[protocol.DocumentUri]any, len(faultyImports))
+		for path, imprt := range faultyImports {
+			if imprt.mod == nil {
+				continue
+			}
+			importDiagnostics, _ := moduleDiagnostics(dm, path, imprt.mod, imprt.errs)
+			importDiagnostics = enc.diagnostics(uri.FromPath(path), importDiagnostics)
+			related[protocol.DocumentUri(uri.FromPath(path))] = newDocumentDiagnosticReport("", importDiagnostics, nil)
+		}
+
+		// the diagnostics would not match the current content
+		if ctx.Err() != nil {
+			return nil, errRequestCancelled
+		}
+		return newDocumentDiagnosticReport(previousResultId, diagnostics, related), nil
+	})
+}
+
+func CreateWorkspaceDiagnosticRequestHandler(dm *documents.DocumentManager) protocol.CustomRequestFunc {
+	return RecoverAnyErr(func(context *glsp.Context, params json.RawMessage) (any, error) {
+		var req WorkspaceDiagnosticParams
+		if err := json.Unmarshal(params, &req); err != nil {
+			return nil, err
+		}
+
+		previousResultIds := make(map[uri.URI]string, len(req.PreviousResultIds))
+		for _, previous := range req.PreviousResultIds {
+			previousResultIds[uri.FromURI(previous.URI)] = previous.Value
+		}
+
+		report := WorkspaceDiagnosticReport{
+			Items: make([]any, 0),
+		}
+		enc := newEncoder(dm)
+		addReport := func(docURI uri.URI, diagnostics []protocol.Diagnostic, version *int32) {
+			diagnostics = enc.diagnostics(docURI, diagnostics)
+			switch docReport := newDocumentDiagnosticReport(previousResultIds[docURI], diagnostics, nil).(type) {
+			case FullDocumentDiagnosticReport:
+				report.Items = append(report.Items, WorkspaceFullDocumentDiagnosticReport{
+					FullDocumentDiagnosticReport: docReport,
+					URI:                          protocol.DocumentUri(docURI),
+					Version:                      version,
+				})
+			case UnchangedDocumentDiagnosticReport:
+				report.Items = append(report.Items, WorkspaceUnchangedDocumentDiagnosticReport{
+					UnchangedDocumentDiagnosticReport: docReport,
+					URI:                               protocol.DocumentUri(docURI),
+					Version:                           version,
+				})
+			}
+		}
+
+		reported := make(map[uri.URI]struct{})
+		for _, summary := range dm.IndexedSummaries() {
+			// the Duden is indexed as well, but it is not part of the workspace
+			if !dm.InWorkspace(summary.FileName) {
+				continue
+			}
+			docURI := uri.FromPath(summary.FileName)
+			reported[docURI] = struct{}{}
+
+			// open documents might differ from the file on disk
+			if doc, ok := dm.Get(string(docURI)); ok {
+				diagnostics, _ := moduleDiagnostics(dm, doc.Path, doc.Module, toPointerSlice(doc.LatestErrors))
+				addReport(docURI, diagnostics, &doc.Version)
+			} else {
+				addReport(docURI, summaryDiagnostics(summary), nil)
+			}
+		}
+		// open documents outside of the workspace are not indexed
+		for _, doc := range dm.GetAll() {
+			if _, ok := reported[doc.Uri]; ok {
+				continue
+			}
+			diagnostics, _ := moduleDiagnostics(dm, doc.Path, doc.Module, toPointerSlice(doc.LatestErrors))
+			addReport(doc.Uri, diagnostics, &doc.Version)
+		}
+		return report, nil
+	})
+}
+
+// asks the client to pull the diagnostics of all documents again,
+// e.g. because the diagnostics of documents changed that the client did not change itself
+// the request is sent in the background, as the response is only read
+// after the current message was handled
+func RefreshDiagnostics(call glsp.CallFunc) {
+	go call(ServerWorkspaceDiagnosticRefresh, nil, nil)
+}
+
+// the diagnostics of a file that is not open
+// the errors of its imports are reported by the imported files themselves
+func summaryDiagnostics(summary *documents.ModuleSummary) []protocol.Diagnostic {
+	diagnostics := make([]protocol.Diagnostic, 0, len(summary.Diagnostics))
+	for _, err := range summary.Diagnostics {
+		diagnostics = append(diagnostics, errToDiagnostic(&err, summary.FileName))
+	}
+	return diagnostics
+}
+
+// returns an unchanged report if the diagnostics did not change since previousResultId
+// and a full report otherwise
+func newDocumentDiagnosticReport(previousResultId string, diagnostics []protocol.Diagnostic, related map[protocol.DocumentUri]any) any {
+	if diagnostics == nil {
+		diagnostics = make([]protocol.Diagnostic, 0)
+	}
+
+	resultId := diagnosticsResultId(diagnostics, related)
+	if previousResultId != "" && previousResultId == resultId {
+		return UnchangedDocumentDiagnosticReport{
+			Kind:     DocumentDiagnosticReportKindUnchanged,
+			ResultId: resultId,
+		}
+	}
+	return FullDocumentDiagnosticReport{
+		Kind:             DocumentDiagnosticReportKindFull,
+		ResultId:         resultId,
+		Items:            diagnostics,
+		RelatedDocuments: related,
+	}
+}
+
+// the result id is derived from the diagnostics themselves,
+// so equal diagnostics always have the same result id, even across restarts
+func diagnosticsResultId(diagnostics []protocol.Diagnostic, related map[protocol.DocumentUri]any) string {
+	// json.Marshal sorts map keys, so the encoding is deterministic
+	data, err := json.Marshal(struct {
+		Diagnostics []protocol.Diagnostic
+		Related     map[protocol.DocumentUri]any
+	}{diagnostics, related})
+	if err != nil {
+		return ""
+	}
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:16])
+}
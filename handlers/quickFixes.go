@@ -0,0 +1,320 @@
+package handlers
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/DDP-Projekt/DDPLS/documents"
+	"github.com/DDP-Projekt/DDPLS/helper"
+	"github.com/DDP-Projekt/Kompilierer/src/ast"
+	"github.com/DDP-Projekt/Kompilierer/src/ddperror"
+	"github.com/DDP-Projekt/Kompilierer/src/ddptypes"
+	"github.com/DDP-Projekt/Kompilierer/src/scanner"
+	"github.com/DDP-Projekt/Kompilierer/src/token"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func init() {
+	registerQuickFix(ddperror.SYN_UNEXPECTED_TOKEN, fixMissingDot)
+	registerQuickFix(ddperror.SYN_EXPECTED_TYPENAME, fixTypeName)
+	registerQuickFix(ddperror.SYN_GENDER_MISMATCH, fixGender)
+}
+
+// scans the content of doc without comments
+func scanDocument(doc *documents.DocumentState) ([]token.Token, bool) {
+	tokens, err := scanner.Scan(scanner.Options{
+		FileName:    doc.Path,
+		Source:      []byte(doc.Content),
+		ScannerMode: scanner.ModeNone,
+	})
+	if err != nil {
+		return nil, false
+	}
+	return slices.DeleteFunc(tokens, func(tok token.Token) bool { return tok.Type == token.COMMENT }), true
+}
+
+// returns the index of the first token that does not end before pos
+// the index of the EOF token is returned if there is none
+func tokenAt(tokens []token.Token, pos token.Position) int {
+	for i, tok := range tokens {
+		if tok.Type == token.EOF || !tok.Range.End.IsBefore(pos) && tok.Range.End != pos {
+			return i
+		}
+	}
+	return len(tokens) - 1
+}
+
+// tokens after which a statement is not finished
+var noStatementEnd = map[token.TokenType]struct{}{
+	token.DOT:   {},
+	token.COLON: {},
+	token.COMMA: {},
+	token.DANN:  {},
+	token.MACHT: {},
+}
+
+// inserts the missing '.' after the last statement when
+// the unexpected token is the first one in its line
+func fixMissingDot(doc *documents.DocumentState, diagnostic protocol.Diagnostic) []quickFix {
+	tokens, ok := scanDocument(doc)
+	if !ok {
+		return nil
+	}
+
+	i := tokenAt(tokens, helper.FromProtocolPosition(diagnostic.Range.Start))
+	if i == 0 {
+		return nil
+	}
+	unexpected, previous := tokens[i], tokens[i-1]
+	if _, ok := noStatementEnd[previous.Type]; ok {
+		return nil
+	}
+	if unexpected.Type != token.EOF && unexpected.Range.Start.Line <= previous.Range.End.Line {
+		return nil
+	}
+
+	insertPos := helper.ToProtocolPosition(previous.Range.End)
+	return []quickFix{{
+		title: "Fehlenden Punkt einfügen",
+		edits: []protocol.TextEdit{{
+			Range:   protocol.Range{Start: insertPos, End: insertPos},
+			NewText: ".",
+		}},
+		isPreferred: true,
+	}}
+}
+
+// maximum number of type names suggested for a misspelled type
+const maxTypeNameSuggestions = 3
+
+// replaces a misspelled type name with similar known type names
+func fixTypeName(doc *documents.DocumentState, diagnostic protocol.Diagnostic) []quickFix {
+	typed := doc.Lines.Slice(helper.FromProtocolRange(diagnostic.Range))
+	if typed == "" {
+		return nil
+	}
+
+	type suggestion struct {
+		name     string
+		distance int
+	}
+
+	maxDistance := max(2, utf8.RuneCountInString(typed)/3)
+	suggestions := make([]suggestion, 0, 8)
+	for _, name := range knownTypeNames(doc.Module) {
+		if distance := helper.EditDistance(typed, name); distance <= maxDistance && name != typed {
+			suggestions = append(suggestions, suggestion{name: name, distance: distance})
+		}
+	}
+
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		return suggestions[i].distance < suggestions[j].distance
+	})
+
+	fixes := make([]quickFix, 0, maxTypeNameSuggestions)
+	for i := 0; i < len(suggestions) && i < maxTypeNameSuggestions; i++ {
+		fixes = append(fixes, quickFix{
+			title: fmt.Sprintf("Zu '%s' ändern", suggestions[i].name),
+			edits: []protocol.TextEdit{{
+				Range:   diagnostic.Range,
+				NewText: suggestions[i].name,
+			}},
+			isPreferred: i == 0,
+		})
+	}
+	return fixes
+}
+
+// returns the names of all builtin types and the types declared in or imported into mod
+func knownTypeNames(mod *ast.Module) []string {
+	primitives := []ddptypes.PrimitiveType{
+		ddptypes.ZAHL,
+		ddptypes.KOMMAZAHL,
+		ddptypes.BYTE,
+		ddptypes.WAHRHEITSWERT,
+		ddptypes.BUCHSTABE,
+		ddptypes.TEXT,
+	}
+
+	names := make([]string, 0, len(primitives)*2+1)
+	for _, typ := range primitives {
+		names = append(names, typ.String(), ddptypes.ListType{ElementType: typ}.String())
+	}
+	names = append(names, ddptypes.VARIABLE.String())
+
+	if mod == nil || mod.Ast == nil {
+		return names
+	}
+
+	for table := mod.Ast.Symbols; table != nil; table = table.Enclosing() {
+		basicTable, ok := table.(*ast.BasicSymbolTable)
+		if !ok {
+			continue
+		}
+
+		for name := range basicTable.Declarations {
+			decl, _, _ := table.LookupDecl(name)
+			if _, isType := ast.IsTypeDecl(decl); isType {
+				names = append(names, decl.Name())
+			}
+		}
+	}
+	return names
+}
+
+// articles and pronouns that have to match the gender of the following type
+// ordered by maskulin, feminin and neutrum
+var (
+	definiteArticles  = [3]token.TokenType{token.DER, token.DIE, token.DAS}
+	fieldArticles     = [3]token.TokenType{token.DEM, token.DER, token.DEM}
+	akkusativArticles = [3]token.TokenType{token.EINEN, token.EINE, token.EIN}
+	dativArticles     = [3]token.TokenType{token.EINEM, token.EINER, token.EINEM}
+	checkArticles     = [3]token.TokenType{token.EIN, token.EINE, token.EIN}
+	negatedArticles   = [3]token.TokenType{token.KEIN, token.KEINE, token.KEIN}
+	forPronouns       = [3]token.TokenType{token.JEDEN, token.JEDE, token.JEDES}
+)
+
+// returns the articles or pronouns that tokens[i] belongs to
+func articleGroup(tokens []token.Token, i int) ([3]token.TokenType, bool) {
+	previous := token.ILLEGAL
+	if i > 0 {
+		previous = tokens[i-1].Type
+	}
+
+	switch tokens[i].Type {
+	case token.DER, token.DIE, token.DAS, token.DEM:
+		// struct fields follow 'aus' or a ','
+		if previous == token.AUS || previous == token.COMMA {
+			return fieldArticles, true
+		}
+		return definiteArticles, true
+	case token.EIN, token.EINE, token.EINEN:
+		if previous == token.IST {
+			return checkArticles, true
+		}
+		return akkusativArticles, true
+	case token.EINEM, token.EINER:
+		return dativArticles, true
+	case token.KEIN, token.KEINE:
+		return negatedArticles, true
+	case token.JEDE, token.JEDEN, token.JEDES:
+		return forPronouns, true
+	}
+	return [3]token.TokenType{}, false
+}
+
+// words between an article and the type it refers to
+var typeModifiers = map[token.TokenType]struct{}{
+	token.OEFFENTLICHE:  {},
+	token.OEFFENTLICHEN: {},
+	token.EXTERN:        {},
+	token.SICHTBARE:     {},
+	token.UND:           {},
+}
+
+// returns the gender of the type that starts at tokens[0]
+func typeGender(mod *ast.Module, tokens []token.Token) (ddptypes.GrammaticalGender, bool) {
+	for len(tokens) > 0 {
+		if _, ok := typeModifiers[tokens[0].Type]; !ok {
+			break
+		}
+		tokens = tokens[1:]
+	}
+	if len(tokens) == 0 {
+		return ddptypes.INVALID_GENDER, false
+	}
+
+	if len(tokens) > 1 && tokens[1].Type == token.LISTE {
+		return ddptypes.ListType{}.Gender(), true
+	}
+
+	switch tokens[0].Type {
+	case token.ZAHL:
+		return ddptypes.ZAHL.Gender(), true
+	case token.KOMMAZAHL:
+		return ddptypes.KOMMAZAHL.Gender(), true
+	case token.BYTE:
+		return ddptypes.BYTE.Gender(), true
+	case token.WAHRHEITSWERT:
+		return ddptypes.WAHRHEITSWERT.Gender(), true
+	case token.BUCHSTABE, token.BUCHSTABEN:
+		return ddptypes.BUCHSTABE.Gender(), true
+	case token.TEXT:
+		return ddptypes.TEXT.Gender(), true
+	case token.VARIABLE:
+		return ddptypes.VARIABLE.Gender(), true
+	case token.ZAHLEN, token.KOMMAZAHLEN, token.VARIABLEN:
+		return ddptypes.ListType{}.Gender(), true
+	case token.FUNKTION, token.KOMBINATION:
+		return ddptypes.FEMININ, true
+	case token.ALIAS:
+		return ddptypes.MASKULIN, true
+	case token.IDENTIFIER:
+		if mod == nil || mod.Ast == nil {
+			return ddptypes.INVALID_GENDER, false
+		}
+		if typ, ok := mod.Ast.Symbols.LookupType(tokens[0].Literal); ok {
+			return typ.Gender(), true
+		}
+	}
+	return ddptypes.INVALID_GENDER, false
+}
+
+// replaces the wrong article or pronoun with the one that matches the gender of the following type
+func fixGender(doc *documents.DocumentState, diagnostic protocol.Diagnostic) []quickFix {
+	tokens, ok := scanDocument(doc)
+	if !ok {
+		return nil
+	}
+
+	i := tokenAt(tokens, helper.FromProtocolPosition(diagnostic.Range.Start))
+	// the error of 'die Größe/den Standardwert einer Zahl' is reported at 'Größe'
+	if t := tokens[i].Type; (t == token.GRÖßE || t == token.STANDARDWERT) && i+1 < len(tokens) {
+		i++
+	}
+
+	group, ok := articleGroup(tokens, i)
+	if !ok {
+		return nil
+	}
+
+	gender, ok := typeGender(doc.Module, tokens[i+1:])
+	if !ok {
+		return nil
+	}
+
+	var suggestion string
+	switch gender {
+	case ddptypes.MASKULIN:
+		suggestion = group[0].String()
+	case ddptypes.FEMININ:
+		suggestion = group[1].String()
+	case ddptypes.NEUTRUM:
+		suggestion = group[2].String()
+	default:
+		return nil
+	}
+
+	// keep the capitalization of the original word
+	typed := tokens[i].Literal
+	if first, _ := utf8.DecodeRuneInString(typed); unicode.IsUpper(first) {
+		r, size := utf8.DecodeRuneInString(suggestion)
+		suggestion = string(unicode.ToUpper(r)) + suggestion[size:]
+	}
+
+	if suggestion == typed {
+		return nil
+	}
+
+	return []quickFix{{
+		title: fmt.Sprintf("Zu '%s' ändern", suggestion),
+		edits: []protocol.TextEdit{{
+			Range:   helper.ToProtocolRange(tokens[i].Range),
+			NewText: suggestion,
+		}},
+		isPreferred: true,
+	}}
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/DDP-Projekt/DDPLS/documents"
+	"github.com/DDP-Projekt/Kompilierer/src/ddperror"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func TestQuickFixes(t *testing.T) {
+	const docUri = "file:///quick_fixes_test.ddp"
+	tests := []struct {
+		source string
+		code   ddperror.Code
+		want   protocol.TextEdit
+	}{
+		{"Die Zahl x ist 1\nSchreibe x.", ddperror.SYN_UNEXPECTED_TOKEN, protocol.TextEdit{Range: protocol.Range{Start: protocol.Position{Line: 0, Character: 16}, End: protocol.Position{Line: 0, Character: 16}}, NewText: "."}},
+		{"Die Zahl x ist 1 [Kommentar]\nSchreibe x.", ddperror.SYN_UNEXPECTED_TOKEN, protocol.TextEdit{Range: protocol.Range{Start: protocol.Position{Line: 0, Character: 16}, End: protocol.Position{Line: 0, Character: 16}}, NewText: "."}},
+		{"Der Zahl x ist 1.", ddperror.SYN_GENDER_MISMATCH, protocol.TextEdit{Range: protocol.Range{Start: protocol.Position{Line: 0, Character: 0}, End: protocol.Position{Line: 0, Character: 3}}, NewText: "Die"}},
+		{"Das Text x ist \"a\".", ddperror.SYN_GENDER_MISMATCH, protocol.TextEdit{Range: protocol.Range{Start: protocol.Position{Line: 0, Character: 0}, End: protocol.Position{Line: 0, Character: 3}}, NewText: "Der"}},
+		{"Für jeden Zahl n von 1 bis 3, mache:\n\tSchreibe n.", ddperror.SYN_GENDER_MISMATCH, protocol.TextEdit{Range: protocol.Range{Start: protocol.Position{Line: 0, Character: 4}, End: protocol.Position{Line: 0, Character: 9}}, NewText: "jede"}},
+		{"Die Zahl x ist 1.\nWenn x ein Zahl ist, dann:\n\tSchreibe x.", ddperror.SYN_GENDER_MISMATCH, protocol.TextEdit{Range: protocol.Range{Start: protocol.Position{Line: 1, Character: 7}, End: protocol.Position{Line: 1, Character: 10}}, NewText: "eine"}},
+		{"Die Funktion f gibt einen Zahl zurück, macht:\n\tGib 1 zurück.\n", ddperror.SYN_GENDER_MISMATCH, protocol.TextEdit{Range: protocol.Range{Start: protocol.Position{Line: 0, Character: 20}, End: protocol.Position{Line: 0, Character: 25}}, NewText: "eine"}},
+	}
+	for _, test := range tests {
+		dm := documents.NewDocumentManager()
+		if err := dm.AddAndParse(docUri, 1, test.source); err != nil {
+			t.Fatal(err)
+		}
+		doc, _ := dm.Get(docUri)
+
+		var edits []protocol.TextEdit
+		for _, err := range doc.LatestErrors {
+			if err.Code != test.code {
+				continue
+			}
+			for _, fixFunc := range quickFixes[err.Code] {
+				for _, fix := range fixFunc(doc, errToDiagnostic(&err, doc.Path)) {
+					edits = append(edits, fix.edits...)
+				}
+			}
+		}
+
+		if len(edits) != 1 || edits[0] != test.want {
+			t.Errorf("%q: got %v, want %v", test.source, edits, test.want)
+		}
+	}
+}
+
+func TestFixMissingDotOnlyAtLineEnd(t *testing.T) {
+	const docUri = "file:///quick_fixes_test.ddp"
+	dm := documents.NewDocumentManager()
+	if err := dm.AddAndParse(docUri, 1, "Wenn 1 gleich 1 ist dann:\n\tSchreibe 1."); err != nil {
+		t.Fatal(err)
+	}
+	doc, _ := dm.Get(docUri)
+
+	unexpected := 0
+	for _, err := range doc.LatestErrors {
+		if err.Code != ddperror.SYN_UNEXPECTED_TOKEN {
+			continue
+		}
+		unexpected++
+		if fixes := fixMissingDot(doc, errToDiagnostic(&err, doc.Path)); len(fixes) != 0 {
+			t.Errorf("missing dot fix offered for %q", err.Msg)
+		}
+	}
+	if unexpected == 0 {
+		t.Fatal("no unexpected token error")
+	}
+}
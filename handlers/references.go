@@ -0,0 +1,689 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/DDP-Projekt/DDPLS/documents"
+	"github.com/DDP-Projekt/DDPLS/helper"
+	"github.com/DDP-Projekt/DDPLS/log"
+	"github.com/DDP-Projekt/DDPLS/uri"
+	"github.com/DDP-Projekt/Kompilierer/src/ast"
+	"github.com/DDP-Projekt/Kompilierer/src/ddptypes"
+	"github.com/DDP-Projekt/Kompilierer/src/scanner"
+	"github.com/DDP-Projekt/Kompilierer/src/token"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func CreateTextDocumentReferences(dm *documents.DocumentManager) protocol.TextDocumentReferencesFunc {
+	return RecoverAnyErr(func(context *glsp.Context, params *protocol.ReferenceParams) ([]protocol.Location, error) {
+		ctx, stop := documentRequestContext(context, dm, params.TextDocument.URI)
+		defer stop()
+		doc, err := dm.GetWithContext(ctx, params.TextDocument.URI)
+		if err != nil {
+			return nil, cancelledOr(ctx, fmt.Errorf("%s not in document map", params.TextDocument.URI))
+		}
+
+		preparer := &referencePreparer{
+			renamePreparer: renamePreparer{
+				pos: decodePosition(dm, doc, params.Position),
+			},
+		}
+
+		ast.VisitModule(doc.Module, preparer)
+		if preparer.decl == nil {
+			return nil, nil
+		}
+
+		collector := newReferenceCollector(preparer.decl, preparer.fieldOf, params.Context.IncludeDeclaration)
+		collector.ctx = ctx
+		collector.collect(dm, collector)
+		// the locations would not match the changed document
+		if ctx.Err() != nil {
+			return nil, errRequestCancelled
+		}
+
+		return newEncoder(dm, doc).locations(collector.locations), nil
+	})
+}
+
+// finds the declaration at a position
+// in addition to the renamePreparer it also resolves
+// declarations that are referenced by alias or type name
+type referencePreparer struct {
+	renamePreparer
+	scope   ast.SymbolTable
+	fieldOf string // name of the struct if decl is a field
+}
+
+var (
+	_ ast.Visitor            = (*referencePreparer)(nil)
+	_ ast.ConditionalVisitor = (*referencePreparer)(nil)
+	_ ast.ScopeSetter        = (*referencePreparer)(nil)
+)
+
+func (r *referencePreparer) SetScope(scope ast.SymbolTable) {
+	r.scope = scope
+}
+
+func (r *referencePreparer) VisitVarDecl(d *ast.VarDecl) ast.VisitResult {
+	if helper.IsInRange(d.TypeRange, r.pos) {
+		r.decl = r.typeDecl(d.Type)
+		return ast.VisitBreak
+	}
+	return r.renamePreparer.VisitVarDecl(d)
+}
+
+func (r *referencePreparer) VisitConstDecl(d *ast.ConstDecl) ast.VisitResult {
+	if helper.IsInRange(d.NameTok.Range, r.pos) {
+		r.decl = d
+		return ast.VisitBreak
+	}
+	return ast.VisitRecurse
+}
+
+func (r *referencePreparer) VisitFuncDecl(d *ast.FuncDecl) ast.VisitResult {
+	if helper.IsInRange(d.ReturnTypeRange, r.pos) {
+		r.decl = r.typeDecl(d.ReturnType)
+		return ast.VisitBreak
+	}
+
+	for _, param := range d.Parameters {
+		if helper.IsInRange(param.TypeRange, r.pos) {
+			r.decl = r.typeDecl(param.Type.Type)
+			return ast.VisitBreak
+		}
+	}
+
+	return r.renamePreparer.VisitFuncDecl(d)
+}
+
+func (r *referencePreparer) VisitStructDecl(d *ast.StructDecl) ast.VisitResult {
+	if helper.IsInRange(d.NameTok.Range, r.pos) {
+		r.decl = d
+		return ast.VisitBreak
+	}
+
+	result := r.renamePreparer.VisitStructDecl(d)
+	if r.decl != nil {
+		r.fieldOf = d.Name()
+	}
+	return result
+}
+
+func (r *referencePreparer) VisitTypeAliasDecl(d *ast.TypeAliasDecl) ast.VisitResult {
+	if helper.IsInRange(d.NameTok.Range, r.pos) {
+		r.decl = d
+	} else if helper.IsInRange(d.UnderlyingRange, r.pos) {
+		r.decl = r.typeDecl(d.Underlying)
+	}
+	return ast.VisitBreak
+}
+
+func (r *referencePreparer) VisitTypeDefDecl(d *ast.TypeDefDecl) ast.VisitResult {
+	if helper.IsInRange(d.NameTok.Range, r.pos) {
+		r.decl = d
+	} else if helper.IsInRange(d.UnderlyingRange, r.pos) {
+		r.decl = r.typeDecl(d.Underlying)
+	}
+	return ast.VisitBreak
+}
+
+func (r *referencePreparer) VisitImportStmt(stmt *ast.ImportStmt) ast.VisitResult {
+	if stmt.SingleModule() == nil {
+		return ast.VisitBreak
+	}
+
+	for _, symbol := range stmt.ImportedSymbols {
+		if helper.IsInRange(symbol.Range, r.pos) {
+			r.decl = stmt.SingleModule().PublicDecls[symbol.Literal]
+			return ast.VisitBreak
+		}
+	}
+	return ast.VisitBreak
+}
+
+func (r *referencePreparer) VisitFuncCall(e *ast.FuncCall) ast.VisitResult {
+	for _, arg := range e.Args {
+		if helper.IsInRange(arg.GetRange(), r.pos) {
+			return ast.VisitRecurse
+		}
+	}
+
+	if e.Func != nil {
+		r.decl = e.Func
+		return ast.VisitBreak
+	}
+	return ast.VisitRecurse
+}
+
+func (r *referencePreparer) VisitStructLiteral(e *ast.StructLiteral) ast.VisitResult {
+	for _, arg := range e.Args {
+		if helper.IsInRange(arg.GetRange(), r.pos) {
+			return ast.VisitRecurse
+		}
+	}
+
+	if e.Struct != nil {
+		r.decl = e.Struct
+		return ast.VisitBreak
+	}
+	return ast.VisitRecurse
+}
+
+func (r *referencePreparer) VisitFieldAccess(e *ast.FieldAccess) ast.VisitResult {
+	return r.visitFieldAccess(e)
+}
+
+func (r *referencePreparer) VisitBinaryExpr(e *ast.BinaryExpr) ast.VisitResult {
+	return r.visitFieldAccess(e)
+}
+
+func (r *referencePreparer) visitFieldAccess(e ast.Expression) ast.VisitResult {
+	field, rhs, ok := asFieldAccess(e)
+	if !ok || !helper.IsInRange(field.GetRange(), r.pos) {
+		return ast.VisitRecurse
+	}
+
+	structType := exprStructType(rhs)
+	if structType == nil || r.scope == nil {
+		return ast.VisitBreak
+	}
+
+	if decl, ok, _ := r.scope.LookupDecl(structType.Name); ok {
+		if structDecl, ok := decl.(*ast.StructDecl); ok {
+			for _, structField := range structDecl.Fields {
+				if structField.Name() == field.Literal.Literal {
+					r.decl = structField
+					r.fieldOf = structDecl.Name()
+				}
+			}
+		}
+	}
+	return ast.VisitBreak
+}
+
+func (r *referencePreparer) VisitCastExpr(e *ast.CastExpr) ast.VisitResult {
+	if !helper.IsInRange(e.Lhs.GetRange(), r.pos) {
+		r.decl = r.typeDecl(e.TargetType)
+		return ast.VisitBreak
+	}
+	return ast.VisitRecurse
+}
+
+func (r *referencePreparer) VisitCastAssigneable(e *ast.CastAssigneable) ast.VisitResult {
+	if !helper.IsInRange(e.Lhs.GetRange(), r.pos) {
+		r.decl = r.typeDecl(e.TargetType)
+		return ast.VisitBreak
+	}
+	return ast.VisitRecurse
+}
+
+// returns the declaration of the given (possibly list) type
+// or nil if it is not a user defined type
+func (r *referencePreparer) typeDecl(typ ddptypes.Type) ast.Declaration {
+	if typ == nil || r.scope == nil {
+		return nil
+	}
+
+	if lt, ok := typ.(ddptypes.ListType); ok {
+		return r.typeDecl(lt.ElementType)
+	}
+
+	name := typ.String()
+	if structType, ok := typ.(*ddptypes.StructType); ok {
+		name = structType.Name
+	}
+
+	decl, exists, _ := r.scope.LookupDecl(name)
+	if _, isType := ast.IsTypeDecl(decl); !exists || !isType {
+		return nil
+	}
+	return decl
+}
+
+// identifies a declaration independent of the parse it came from
+// as every document parses its imports on its own
+type declKey struct {
+	file string
+	name string
+	rang token.Range
+}
+
+func keyOf(decl ast.Declaration) declKey {
+	if funDecl, ok := decl.(*ast.FuncDecl); ok && ast.IsGenericInstantiation(funDecl) {
+		return keyOf(funDecl.GenericInstantiation.GenericDecl)
+	}
+
+	key := declKey{
+		name: decl.Name(),
+		rang: decl.GetRange(),
+	}
+	if decl.Module() != nil {
+		key.file = decl.Module().FileName
+	}
+	return key
+}
+
+// returns the struct type of expr if it can be determined
+// without typechecking, nil otherwise
+func exprStructType(expr ast.Expression) *ddptypes.StructType {
+	var typ ddptypes.Type
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		switch decl := expr.Declaration.(type) {
+		case *ast.VarDecl:
+			typ = decl.Type
+		case *ast.ConstDecl:
+			typ = decl.Type
+		}
+	case *ast.FieldAccess, *ast.BinaryExpr:
+		fieldIdent, rhs, ok := asFieldAccess(expr)
+		if !ok {
+			return nil
+		}
+		structType := exprStructType(rhs)
+		if structType == nil {
+			return nil
+		}
+		for _, field := range structType.Fields {
+			if field.Name == fieldIdent.Literal.Literal {
+				typ = field.Type
+			}
+		}
+	case *ast.Grouping:
+		return exprStructType(expr.Expr)
+	}
+
+	if typ == nil {
+		return nil
+	}
+	structType, _ := ddptypes.GetUnderlying(typ).(*ddptypes.StructType)
+	return structType
+}
+
+// field accesses are either parsed as FieldAccess
+// or as BinaryExpr with the BIN_FIELD_ACCESS operator
+// returns the field and the accessed struct expression
+func asFieldAccess(expr ast.Expression) (*ast.Ident, ast.Expression, bool) {
+	switch expr := expr.(type) {
+	case *ast.FieldAccess:
+		return expr.Field, expr.Rhs, true
+	case *ast.BinaryExpr:
+		if field, ok := expr.Lhs.(*ast.Ident); ok && expr.Operator == ast.BIN_FIELD_ACCESS {
+			return field, expr.Rhs, true
+		}
+	}
+	return nil, nil, false
+}
+
+// collects all references to a declaration
+type referenceCollector struct {
+	key                declKey
+	fieldOf            string // name of the struct if decl is a field
+	isTypeDecl         bool
+	includeDeclaration bool
+	docs               map[string]*documents.DocumentState // open documents by module filename
+	mod                *ast.Module                         // the module that is currently visited
+	stale              bool                                // wether mod is an outdated version of an open document
+	ctx                context.Context                     // stops the visit when done, may be nil
+	typeRanges         map[*ast.Module][]token.Range       // ranges that might contain the type name
+	aliasRanges        map[*ast.Module][]token.Range       // the parts of function calls between their arguments
+	seen               map[protocol.Location]struct{}
+	locations          []protocol.Location
+}
+
+var (
+	_ ast.Visitor                = (*referenceCollector)(nil)
+	_ ast.ConditionalVisitor     = (*referenceCollector)(nil)
+	_ ast.ModuleSetter           = (*referenceCollector)(nil)
+	_ ast.VarDeclVisitor         = (*referenceCollector)(nil)
+	_ ast.FuncDeclVisitor        = (*referenceCollector)(nil)
+	_ ast.StructDeclVisitor      = (*referenceCollector)(nil)
+	_ ast.IdentVisitor           = (*referenceCollector)(nil)
+	_ ast.FuncCallVisitor        = (*referenceCollector)(nil)
+	_ ast.CastExprVisitor        = (*referenceCollector)(nil)
+	_ ast.CastAssigneableVisitor = (*referenceCollector)(nil)
+)
+
+func newReferenceCollector(decl ast.Declaration, fieldOf string, includeDeclaration bool) *referenceCollector {
+	_, isTypeDecl := ast.IsTypeDecl(decl)
+	return &referenceCollector{
+		key:                keyOf(decl),
+		fieldOf:            fieldOf,
+		isTypeDecl:         isTypeDecl,
+		includeDeclaration: includeDeclaration,
+		docs:               make(map[string]*documents.DocumentState),
+		typeRanges:         make(map[*ast.Module][]token.Range),
+		aliasRanges:        make(map[*ast.Module][]token.Range),
+		seen:               make(map[protocol.Location]struct{}),
+	}
+}
+
+// visits the open documents, all indexed modules and the modules they import
+// visitor is r or a visitor that embeds it
+func (r *referenceCollector) collect(dm *documents.DocumentManager, visitor ast.Visitor) {
+	r.setDocuments(dm.GetAll())
+
+	modules, _ := workspaceModules(dm, r.key.file)
+	for _, mod := range modules {
+		if isCancelled(r.ctx) {
+			return
+		}
+		ast.VisitModuleRec(mod, visitor)
+	}
+
+	if r.isTypeDecl {
+		r.collectTypeNames()
+	}
+	r.collectAliasWords()
+}
+
+// sets the open documents, which are used to resolve uris and contents
+func (r *referenceCollector) setDocuments(docs []*documents.DocumentState) {
+	for _, doc := range docs {
+		if doc.Module != nil {
+			r.docs[doc.Module.FileName] = doc
+		}
+	}
+}
+
+func (r *referenceCollector) matches(decl ast.Declaration) bool {
+	return decl != nil && keyOf(decl) == r.key
+}
+
+func (r *referenceCollector) uriOf(mod *ast.Module) protocol.DocumentUri {
+	if doc, ok := r.docs[mod.FileName]; ok {
+		return protocol.DocumentUri(doc.Uri)
+	}
+	return protocol.DocumentUri(uri.FromPath(mod.FileName))
+}
+
+func (r *referenceCollector) add(rang protocol.Range) {
+	location := protocol.Location{
+		URI:   r.uriOf(r.mod),
+		Range: rang,
+	}
+	if _, ok := r.seen[location]; ok {
+		return
+	}
+	r.seen[location] = struct{}{}
+	r.locations = append(r.locations, location)
+}
+
+func (r *referenceCollector) addDeclaration(rang token.Range) {
+	if r.includeDeclaration {
+		r.add(helper.ToProtocolRange(rang))
+	}
+}
+
+func (r *referenceCollector) addTypeRange(rang token.Range) {
+	if r.isTypeDecl {
+		r.typeRanges[r.mod] = append(r.typeRanges[r.mod], rang)
+	}
+}
+
+// returns the tokens of the source of mod
+// open documents are scanned instead of the file on disk
+func (r *referenceCollector) scan(mod *ast.Module) ([]token.Token, bool) {
+	var src []byte
+	if doc, ok := r.docs[mod.FileName]; ok {
+		src = []byte(doc.Content)
+	} else if content, err := os.ReadFile(mod.FileName); err == nil {
+		src = content
+	} else {
+		log.Warningf("could not read %s: %s", mod.FileName, err)
+		return nil, false
+	}
+
+	tokens, err := scanner.Scan(scanner.Options{
+		FileName:    mod.FileName,
+		Source:      src,
+		ScannerMode: scanner.ModeNone,
+	})
+	if err != nil {
+		log.Warningf("could not scan %s: %s", mod.FileName, err)
+		return nil, false
+	}
+	return tokens, true
+}
+
+// type names are not part of the ast, so we scan the source
+// and look for the name inside the collected type ranges
+func (r *referenceCollector) collectTypeNames() {
+	for mod, ranges := range r.typeRanges {
+		tokens, ok := r.scan(mod)
+		if !ok {
+			continue
+		}
+
+		r.mod = mod
+		for _, tok := range tokens {
+			if tok.Type != token.IDENTIFIER || tok.Literal != r.key.name {
+				continue
+			}
+
+			for _, rang := range ranges {
+				if rangeContains(rang, tok.Range) {
+					r.add(helper.ToProtocolRange(tok.Range))
+					break
+				}
+			}
+		}
+	}
+}
+
+// the words of the alias of a function call are not part of the ast,
+// so we scan the source and add the words between the arguments,
+// from the first to the last token of every part of the call that is not an argument
+func (r *referenceCollector) collectAliasWords() {
+	for mod, ranges := range r.aliasRanges {
+		tokens, ok := r.scan(mod)
+		if !ok {
+			continue
+		}
+
+		r.mod = mod
+		for _, rang := range ranges {
+			first := sort.Search(len(tokens), func(i int) bool {
+				return !tokens[i].Range.Start.IsBefore(rang.Start)
+			})
+			last := first
+			for last < len(tokens) && tokens[last].Type != token.EOF && rangeContains(rang, tokens[last].Range) {
+				last++
+			}
+			if last > first {
+				r.add(helper.ToProtocolRange(token.Range{Start: tokens[first].Range.Start, End: tokens[last-1].Range.End}))
+			}
+		}
+	}
+}
+
+func rangeContains(outer, inner token.Range) bool {
+	return !inner.Start.IsBefore(outer.Start) && !inner.End.IsBehind(outer.End)
+}
+
+func (*referenceCollector) Visitor() {}
+
+func (r *referenceCollector) SetModule(mod *ast.Module) {
+	r.mod = mod
+	// imports and indexed modules are parsed from disk, but the locations must match the open document
+	doc, isOpen := r.docs[mod.FileName]
+	r.stale = isOpen && doc.Module != mod
+}
+
+func (r *referenceCollector) ShouldVisit(ast.Node) bool {
+	return !r.stale && !isCancelled(r.ctx)
+}
+
+func (r *referenceCollector) VisitVarDecl(d *ast.VarDecl) ast.VisitResult {
+	if r.matches(d) {
+		r.addDeclaration(d.NameTok.Range)
+	}
+	r.addTypeRange(d.TypeRange)
+	return ast.VisitRecurse
+}
+
+func (r *referenceCollector) VisitConstDecl(d *ast.ConstDecl) ast.VisitResult {
+	if r.matches(d) {
+		r.addDeclaration(d.NameTok.Range)
+	}
+	return ast.VisitRecurse
+}
+
+func (r *referenceCollector) VisitFuncDecl(d *ast.FuncDecl) ast.VisitResult {
+	if r.matches(d) {
+		r.addDeclaration(d.NameTok.Range)
+	}
+
+	r.addTypeRange(d.ReturnTypeRange)
+	for _, param := range d.Parameters {
+		r.addTypeRange(param.TypeRange)
+	}
+
+	if d.Body == nil {
+		return ast.VisitRecurse
+	}
+
+	for _, param := range d.Parameters {
+		decl, _, _ := d.Body.Symbols.LookupDecl(param.Name.Literal)
+		if !r.matches(decl) {
+			continue
+		}
+
+		r.addDeclaration(param.Name.Range)
+		for _, alias := range d.Aliases {
+			for _, aliasToken := range alias.Tokens {
+				if helper.AliasParamNameEquals(aliasToken, decl.Name()) {
+					r.add(helper.GetAliasParamProtocolRange(aliasToken))
+				}
+			}
+		}
+	}
+
+	return ast.VisitRecurse
+}
+
+func (r *referenceCollector) VisitStructDecl(d *ast.StructDecl) ast.VisitResult {
+	if r.matches(d) {
+		r.addDeclaration(d.NameTok.Range)
+	}
+
+	for _, field := range d.Fields {
+		if !r.matches(field) {
+			continue
+		}
+
+		for _, alias := range d.Aliases {
+			for _, aliasToken := range alias.Tokens {
+				if helper.AliasParamNameEquals(aliasToken, field.Name()) {
+					r.add(helper.GetAliasParamProtocolRange(aliasToken))
+				}
+			}
+		}
+	}
+
+	return ast.VisitRecurse
+}
+
+func (r *referenceCollector) VisitTypeAliasDecl(d *ast.TypeAliasDecl) ast.VisitResult {
+	if r.matches(d) {
+		r.addDeclaration(d.NameTok.Range)
+	}
+	r.addTypeRange(d.UnderlyingRange)
+	return ast.VisitRecurse
+}
+
+func (r *referenceCollector) VisitTypeDefDecl(d *ast.TypeDefDecl) ast.VisitResult {
+	if r.matches(d) {
+		r.addDeclaration(d.NameTok.Range)
+	}
+	r.addTypeRange(d.UnderlyingRange)
+	return ast.VisitRecurse
+}
+
+func (r *referenceCollector) VisitImportStmt(stmt *ast.ImportStmt) ast.VisitResult {
+	if stmt.SingleModule() == nil {
+		return ast.VisitRecurse
+	}
+
+	for _, symbol := range stmt.ImportedSymbols {
+		if r.matches(stmt.SingleModule().PublicDecls[symbol.Literal]) {
+			r.add(helper.ToProtocolRange(symbol.Range))
+		}
+	}
+	return ast.VisitRecurse
+}
+
+func (r *referenceCollector) VisitIdent(e *ast.Ident) ast.VisitResult {
+	if r.matches(e.Declaration) {
+		r.add(helper.ToProtocolRange(e.GetRange()))
+	}
+	return ast.VisitRecurse
+}
+
+func (r *referenceCollector) VisitFieldAccess(e *ast.FieldAccess) ast.VisitResult {
+	r.visitFieldAccess(e)
+	return ast.VisitRecurse
+}
+
+func (r *referenceCollector) VisitBinaryExpr(e *ast.BinaryExpr) ast.VisitResult {
+	r.visitFieldAccess(e)
+	return ast.VisitRecurse
+}
+
+// field accesses are not resolved by the parser
+// so we compare the names and the struct type if it is known
+func (r *referenceCollector) visitFieldAccess(e ast.Expression) {
+	field, rhs, ok := asFieldAccess(e)
+	if !ok || r.fieldOf == "" || field.Literal.Literal != r.key.name {
+		return
+	}
+
+	if structType := exprStructType(rhs); structType == nil || structType.Name == r.fieldOf {
+		r.add(helper.ToProtocolRange(field.GetRange()))
+	}
+}
+
+func (r *referenceCollector) VisitFuncCall(e *ast.FuncCall) ast.VisitResult {
+	if e.Func != nil && r.matches(e.Func) {
+		r.aliasRanges[r.mod] = append(r.aliasRanges[r.mod], rangesBetweenArgs(e.Range, e.Args)...)
+	}
+	return ast.VisitRecurse
+}
+
+func (r *referenceCollector) VisitStructLiteral(e *ast.StructLiteral) ast.VisitResult {
+	if e.Struct != nil && r.matches(e.Struct) {
+		r.add(helper.ToProtocolRange(e.Range))
+	}
+	return ast.VisitRecurse
+}
+
+func (r *referenceCollector) VisitCastExpr(e *ast.CastExpr) ast.VisitResult {
+	for _, rang := range helper.CutRangeOut(e.Range, e.Lhs.GetRange()) {
+		r.addTypeRange(rang)
+	}
+	return ast.VisitRecurse
+}
+
+func (r *referenceCollector) VisitCastAssigneable(e *ast.CastAssigneable) ast.VisitResult {
+	for _, rang := range helper.CutRangeOut(e.Range, e.Lhs.GetRange()) {
+		r.addTypeRange(rang)
+	}
+	return ast.VisitRecurse
+}
+
+func (r *referenceCollector) VisitTypeOpExpr(e *ast.TypeOpExpr) ast.VisitResult {
+	r.addTypeRange(e.Range)
+	return ast.VisitRecurse
+}
+
+func (r *referenceCollector) VisitTypeCheck(e *ast.TypeCheck) ast.VisitResult {
+	for _, rang := range helper.CutRangeOut(e.Range, e.Lhs.GetRange()) {
+		r.addTypeRange(rang)
+	}
+	return ast.VisitRecurse
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/DDP-Projekt/DDPLS/documents"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func TestFuncCallReferences(t *testing.T) {
+	const docUri = "file:///references_test.ddp"
+	const source = `Die Funktion addiere mit den Parametern a und b vom Typ Zahl und Zahl, gibt eine Zahl zurück, macht:
+	Gib a plus b zurück.
+Und kann so benutzt werden:
+	"die Summe von <a> und <b>"
+Die Zahl z ist die Summe von 1 und (die Summe von 2 und 3).
+`
+	dm := documents.NewDocumentManager()
+	if err := dm.AddAndParse(docUri, 1, source); err != nil {
+		t.Fatal(err)
+	}
+
+	locations, err := CreateTextDocumentReferences(dm)(&glsp.Context{}, &protocol.ReferenceParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: docUri},
+			Position:     protocol.Position{Line: 0, Character: 15}, // addiere
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only the words of the alias, not the arguments
+	want := []protocol.Range{
+		{Start: protocol.Position{Line: 4, Character: 15}, End: protocol.Position{Line: 4, Character: 28}}, // die Summe von
+		{Start: protocol.Position{Line: 4, Character: 31}, End: protocol.Position{Line: 4, Character: 34}}, // und
+		{Start: protocol.Position{Line: 4, Character: 36}, End: protocol.Position{Line: 4, Character: 49}}, // die Summe von
+		{Start: protocol.Position{Line: 4, Character: 52}, End: protocol.Position{Line: 4, Character: 55}}, // und
+	}
+	got := make([]protocol.Range, 0, len(locations))
+	for _, location := range locations {
+		got = append(got, location.Range)
+	}
+	slices.SortFunc(got, func(a, b protocol.Range) int {
+		return int(a.Start.Character) - int(b.Start.Character)
+	})
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -2,29 +2,35 @@ package handlers
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/DDP-Projekt/DDPLS/documents"
 	"github.com/DDP-Projekt/DDPLS/helper"
-	"github.com/DDP-Projekt/DDPLS/uri"
 	"github.com/DDP-Projekt/Kompilierer/src/ast"
+	"github.com/DDP-Projekt/Kompilierer/src/ddperror"
+	"github.com/DDP-Projekt/Kompilierer/src/scanner"
+	"github.com/DDP-Projekt/Kompilierer/src/token"
 	"github.com/tliron/glsp"
 	protocol "github.com/tliron/glsp/protocol_3_16"
 )
 
 func CreateTextDocumentPrepareRename(dm *documents.DocumentManager) protocol.TextDocumentPrepareRenameFunc {
 	return RecoverAnyErr(func(context *glsp.Context, params *protocol.PrepareRenameParams) (any, error) {
-		var docMod *ast.Module
-		if doc, ok := dm.Get(params.TextDocument.URI); !ok {
+		doc, ok := dm.Get(params.TextDocument.URI)
+		if !ok {
 			return nil, fmt.Errorf("document not found %s", params.TextDocument.URI)
-		} else {
-			docMod = doc.Module
 		}
 
-		preparer := renamePreparer{
-			pos: params.Position,
+		preparer := referencePreparer{
+			renamePreparer: renamePreparer{
+				pos: decodePosition(dm, doc, params.Position),
+			},
 		}
 
-		ast.VisitModuleRec(docMod, &preparer)
+		ast.VisitModule(doc.Module, &preparer)
+		if err := checkRenameable(dm, preparer.decl); err != nil {
+			return nil, err
+		}
 
 		return protocol.DefaultBehavior{
 			DefaultBehavior: preparer.decl != nil,
@@ -117,137 +123,134 @@ func (r *renamePreparer) VisitStructDecl(d *ast.StructDecl) ast.VisitResult {
 
 func CreateTextDocumentRename(dm *documents.DocumentManager) protocol.TextDocumentRenameFunc {
 	return RecoverAnyErr(func(context *glsp.Context, params *protocol.RenameParams) (*protocol.WorkspaceEdit, error) {
-		var docMod *ast.Module
-		if doc, ok := dm.Get(params.TextDocument.URI); !ok {
-			return nil, fmt.Errorf("document not found %s", params.TextDocument.URI)
-		} else {
-			docMod = doc.Module
+		ctx, stop := documentRequestContext(context, dm, params.TextDocument.URI)
+		defer stop()
+		doc, err := dm.GetWithContext(ctx, params.TextDocument.URI)
+		if err != nil {
+			return nil, cancelledOr(ctx, fmt.Errorf("document not found %s", params.TextDocument.URI))
 		}
 
-		renamePreparer := renamePreparer{
-			pos: params.Position,
+		preparer := referencePreparer{
+			renamePreparer: renamePreparer{
+				pos: decodePosition(dm, doc, params.Position),
+			},
 		}
 
-		ast.VisitModuleRec(docMod, &renamePreparer)
-		if renamePreparer.decl == nil {
+		ast.VisitModule(doc.Module, &preparer)
+		if preparer.decl == nil {
 			return nil, fmt.Errorf("no declaration found at position")
 		}
+		if err := checkRenameable(dm, preparer.decl); err != nil {
+			return nil, err
+		}
+		if !isValidName(params.NewName) {
+			return nil, fmt.Errorf("'%s' is not a valid name", params.NewName)
+		}
 
+		// the declaration might be used in every module of the workspace
 		renamer := renamer{
-			newName: params.NewName,
-			decl:    renamePreparer.decl,
-			changes: make(map[string][]protocol.TextEdit),
-			uri:     params.TextDocument.URI,
+			referenceCollector: newReferenceCollector(preparer.decl, preparer.fieldOf, true),
+		}
+		renamer.ctx = ctx
+		renamer.collect(dm, &renamer)
+		// the edits would not match the changed document
+		if ctx.Err() != nil {
+			return nil, errRequestCancelled
 		}
-
-		ast.VisitModuleRec(docMod, &renamer)
 
 		edit := &protocol.WorkspaceEdit{
-			Changes: renamer.changes,
+			Changes: make(map[protocol.DocumentUri][]protocol.TextEdit),
+		}
+		for _, location := range renamer.locations {
+			edit.Changes[location.URI] = append(edit.Changes[location.URI], protocol.TextEdit{
+				Range:   location.Range,
+				NewText: params.NewName,
+			})
 		}
 
-		return edit, nil
+		return newEncoder(dm, doc).workspaceEdit(edit), nil
 	})
 }
 
-type renamer struct {
-	changes map[protocol.DocumentUri][]protocol.TextEdit
-	newName string
-	decl    ast.Declaration
-	uri     protocol.DocumentUri
-}
-
-var _ ast.Visitor = (*renamer)(nil)
-
-func (r *renamer) Visitor() {}
-
-func (r *renamer) VisitIdent(e *ast.Ident) ast.VisitResult {
-	if e.Declaration != r.decl {
-		return ast.VisitRecurse
+// declarations outside of the workspace, e.g. in the Duden, are not renamed
+// as the files that use them could not be changed as well
+func checkRenameable(dm *documents.DocumentManager, decl ast.Declaration) error {
+	if decl == nil || decl.Module() == nil {
+		return nil
 	}
+	if !dm.InWorkspace(decl.Module().FileName) {
+		return fmt.Errorf("'%s' is declared outside of the workspace in %s and can not be renamed", decl.Name(), decl.Module().FileName)
+	}
+	return nil
+}
 
-	// uri := protocol.DocumentUri(uri.FromPath(e.Declaration.Mod.FileName))
-	r.changes[r.uri] = append(r.changes[r.uri], protocol.TextEdit{
-		Range:   helper.ToProtocolRange(e.GetRange()),
-		NewText: r.newName,
+// reports wether name scans to a single identifier
+func isValidName(name string) bool {
+	tokens, err := scanner.Scan(scanner.Options{
+		FileName:     "name",
+		Source:       []byte(name),
+		ScannerMode:  scanner.ModeNone,
+		ErrorHandler: ddperror.EmptyHandler,
 	})
-	return ast.VisitRecurse
+	return err == nil && len(tokens) == 2 && tokens[0].Type == token.IDENTIFIER && tokens[0].Literal == name
 }
 
-func (r *renamer) VisitVarDecl(d *ast.VarDecl) ast.VisitResult {
-	if d != r.decl {
-		return ast.VisitRecurse
-	}
+// collects the locations of all references to a declaration that contain its name
+// function calls only reference the declaration by alias
+// struct literals and struct aliases may contain the name of the struct
+type renamer struct {
+	*referenceCollector
+}
 
-	// uri := protocol.DocumentUri(uri.FromPath(d.Mod.FileName))
-	r.changes[r.uri] = append(r.changes[r.uri], protocol.TextEdit{
-		Range:   helper.ToProtocolRange(d.NameTok.Range),
-		NewText: r.newName,
-	})
+var (
+	_ ast.Visitor           = (*renamer)(nil)
+	_ ast.StructDeclVisitor = (*renamer)(nil)
+)
 
+func (r *renamer) VisitFuncCall(*ast.FuncCall) ast.VisitResult {
 	return ast.VisitRecurse
 }
 
-func (r *renamer) VisitFuncDecl(d *ast.FuncDecl) ast.VisitResult {
-	if d == r.decl {
-		uri := protocol.DocumentUri(uri.FromPath(d.Mod.FileName))
-		r.changes[uri] = append(r.changes[uri], protocol.TextEdit{
-			Range:   helper.ToProtocolRange(d.NameTok.Range),
-			NewText: r.newName,
-		})
-	}
-
-	for i := range d.Parameters {
-		name := d.Parameters[i].Name
-		if d.Body == nil {
-			return ast.VisitRecurse
-		}
-
-		decl, _, _ := d.Body.Symbols.LookupDecl(name.Literal)
-		if decl == r.decl {
-			// uri := protocol.DocumentUri(uri.FromPath(d.Mod.FileName))
-			r.changes[r.uri] = append(r.changes[r.uri], protocol.TextEdit{
-				Range:   helper.ToProtocolRange(name.Range),
-				NewText: r.newName,
-			})
-
-			for _, alias := range d.Aliases {
-				for _, aliasToken := range alias.Tokens {
-					if !helper.AliasParamNameEquals(aliasToken, decl.Name()) {
-						continue
-					}
-
-					r.changes[r.uri] = append(r.changes[r.uri], protocol.TextEdit{
-						Range:   helper.GetAliasParamProtocolRange(aliasToken),
-						NewText: r.newName,
-					})
+func (r *renamer) VisitStructDecl(d *ast.StructDecl) ast.VisitResult {
+	if r.matches(d) {
+		for _, alias := range d.Aliases {
+			for _, aliasToken := range alias.Tokens {
+				if aliasToken.Type == token.IDENTIFIER && aliasToken.Literal == d.Name() {
+					r.add(helper.GetAliasTokenProtocolRange(aliasToken))
 				}
 			}
 		}
 	}
-
-	return ast.VisitRecurse
+	return r.referenceCollector.VisitStructDecl(d)
 }
 
-func (r *renamer) VisitStructDecl(d *ast.StructDecl) ast.VisitResult {
-	for _, field := range d.Fields {
-		if r.decl != field {
-			continue
+func (r *renamer) VisitStructLiteral(e *ast.StructLiteral) ast.VisitResult {
+	if e.Struct != nil && r.matches(e.Struct) {
+		for _, rang := range rangesBetweenArgs(e.Range, e.Args) {
+			r.addTypeRange(rang)
 		}
+	}
+	return ast.VisitRecurse
+}
 
-		for _, alias := range d.Aliases {
-			for _, aliasToken := range alias.Tokens {
-				if !helper.AliasParamNameEquals(aliasToken, field.Name()) {
-					continue
-				}
-
-				r.changes[r.uri] = append(r.changes[r.uri], protocol.TextEdit{
-					Range:   helper.GetAliasParamProtocolRange(aliasToken),
-					NewText: r.newName,
-				})
-			}
+// returns the parts of rang that are not covered by one of the arguments
+func rangesBetweenArgs(rang token.Range, args map[string]ast.Expression) []token.Range {
+	argRanges := make([]token.Range, 0, len(args))
+	for _, arg := range args {
+		// default values are declared somewhere else
+		if arg != nil && rangeContains(rang, arg.GetRange()) {
+			argRanges = append(argRanges, arg.GetRange())
 		}
 	}
+	sort.Slice(argRanges, func(i, j int) bool {
+		return argRanges[i].Start.IsBefore(argRanges[j].Start)
+	})
 
-	return ast.VisitRecurse
+	result := make([]token.Range, 0, len(argRanges)+1)
+	for _, argRange := range argRanges {
+		parts := helper.CutRangeOut(rang, argRange)
+		result = append(result, parts[0])
+		rang = parts[1]
+	}
+	return append(result, rang)
 }
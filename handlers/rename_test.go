@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/DDP-Projekt/DDPLS/documents"
+	"github.com/DDP-Projekt/DDPLS/uri"
+	"github.com/DDP-Projekt/Kompilierer/src/ddppath"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+const renameTestDecl = `Wir nennen die öffentliche Kombination aus
+	der öffentlichen Zahl x mit Standardwert 0,
+	der öffentlichen Zahl y mit Standardwert 0,
+einen Punkt, und erstellen sie so:
+	"der Punkt" oder
+	"ein Punkt mit x gleich <x>"
+
+Wir definieren eine Nummer öffentlich als eine Zahl.
+`
+
+const renameTestUse = `Binde "decl" ein.
+
+Die Funktion bewege mit dem Parameter p vom Typ Punkt, gibt einen Punkt zurück, macht:
+	Gib ein Punkt mit x gleich ((x von p) plus 1) zurück.
+Und kann so benutzt werden:
+	"bewege <p>"
+
+Die Funktion nummer mit dem Parameter z vom Typ Zahl, gibt eine Nummer zurück, macht:
+	Gib z als Nummer zurück.
+Und kann so benutzt werden:
+	"die Nummer von <z>"
+
+Die Punkt Liste punkte ist eine Liste, die aus der Punkt, bewege (der Punkt) besteht.
+Die Nummer n ist 1 als Nummer.
+Die Nummer m ist die Nummer von 2.
+Die Nummer Liste nummern ist eine Liste, die aus n, m besteht.
+Die Zahl z ist n als Zahl.
+`
+
+// applies the edits of a WorkspaceEdit to content
+func applyTextEdits(content string, edits []protocol.TextEdit) string {
+	lines := documents.NewLineIndex(content)
+	edits = slices.Clone(edits)
+	// the edits are applied from the end, so that the offsets of the others stay valid
+	slices.SortFunc(edits, func(a, b protocol.TextEdit) int {
+		return lines.ProtocolOffset(b.Range.Start, documents.PositionEncodingUTF16) - lines.ProtocolOffset(a.Range.Start, documents.PositionEncodingUTF16)
+	})
+	for _, edit := range edits {
+		start := lines.ProtocolOffset(edit.Range.Start, documents.PositionEncodingUTF16)
+		end := lines.ProtocolOffset(edit.Range.End, documents.PositionEncodingUTF16)
+		content = content[:start] + edit.NewText + content[end:]
+	}
+	return content
+}
+
+// the position of the first occurrence of substr in content
+func positionOf(content, substr string) protocol.Position {
+	return documents.NewLineIndex(content).ProtocolPosition(strings.Index(content, substr), documents.PositionEncodingUTF16)
+}
+
+func TestRenameTypes(t *testing.T) {
+	dir := t.TempDir()
+	declPath, usePath := filepath.Join(dir, "decl.ddp"), filepath.Join(dir, "use.ddp")
+	for path, content := range map[string]string{declPath: renameTestDecl, usePath: renameTestUse} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	declUri, useUri := string(uri.FromPath(declPath)), string(uri.FromPath(usePath))
+
+	tests := []struct {
+		name     string
+		position protocol.Position // in the declaring document
+		newName  string
+		wantDecl string
+		wantUse  string
+	}{
+		{
+			name:     "struct",
+			position: positionOf(renameTestDecl, "Punkt, und"),
+			newName:  "Ort",
+			wantDecl: strings.ReplaceAll(renameTestDecl, "Punkt", "Ort"),
+			wantUse:  strings.ReplaceAll(renameTestUse, "Punkt", "Ort"),
+		},
+		{
+			name:     "typedef",
+			position: positionOf(renameTestDecl, "Nummer öffentlich"),
+			newName:  "Kennung",
+			wantDecl: strings.ReplaceAll(renameTestDecl, "Nummer", "Kennung"),
+			// the alias of the function nummer is not a type
+			wantUse: strings.ReplaceAll(strings.ReplaceAll(renameTestUse, "Nummer", "Kennung"), "die Kennung von", "die Nummer von"),
+		},
+	}
+
+	for _, test := range tests {
+		dm := documents.NewDocumentManager()
+		dm.SetWorkspaceFolders([]string{dir})
+		if err := dm.AddAndParse(declUri, 1, renameTestDecl); err != nil {
+			t.Fatal(err)
+		}
+		if err := dm.AddAndParse(useUri, 1, renameTestUse); err != nil {
+			t.Fatal(err)
+		}
+		for _, docUri := range []string{declUri, useUri} {
+			if doc, _ := dm.Get(docUri); len(doc.LatestErrors) != 0 {
+				t.Fatalf("%s has errors: %v", docUri, doc.LatestErrors)
+			}
+		}
+
+		edit, err := CreateTextDocumentRename(dm)(&glsp.Context{}, &protocol.RenameParams{
+			TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: declUri},
+				Position:     test.position,
+			},
+			NewName: test.newName,
+		})
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if len(edit.Changes) != 2 {
+			t.Errorf("%s: got edits for %d documents, want 2", test.name, len(edit.Changes))
+		}
+		if got := applyTextEdits(renameTestDecl, edit.Changes[declUri]); got != test.wantDecl {
+			t.Errorf("%s: decl.ddp after the rename:\n%s\nwant\n%s", test.name, got, test.wantDecl)
+		}
+		if got := applyTextEdits(renameTestUse, edit.Changes[useUri]); got != test.wantUse {
+			t.Errorf("%s: use.ddp after the rename:\n%s\nwant\n%s", test.name, got, test.wantUse)
+		}
+	}
+}
+
+// declarations in the Duden or outside of the workspace folders are not renamed
+func TestRenameOutsideOfWorkspace(t *testing.T) {
+	workspace := t.TempDir()
+	for _, path := range []string{
+		filepath.Join(ddppath.Duden, "Punkt.ddp"),
+		filepath.Join(t.TempDir(), "decl.ddp"),
+	} {
+		dm := documents.NewDocumentManager()
+		dm.SetWorkspaceFolders([]string{workspace})
+		docUri := string(uri.FromPath(path))
+		if err := dm.AddAndParse(docUri, 1, renameTestDecl); err != nil {
+			t.Fatal(err)
+		}
+
+		position := protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: docUri},
+			Position:     positionOf(renameTestDecl, "Punkt, und"),
+		}
+		if _, err := CreateTextDocumentPrepareRename(dm)(&glsp.Context{}, &protocol.PrepareRenameParams{TextDocumentPositionParams: position}); err == nil {
+			t.Errorf("%s: preparing the rename did not fail", path)
+		}
+		if _, err := CreateTextDocumentRename(dm)(&glsp.Context{}, &protocol.RenameParams{TextDocumentPositionParams: position, NewName: "Ort"}); err == nil {
+			t.Errorf("%s: the rename did not fail", path)
+		}
+	}
+}
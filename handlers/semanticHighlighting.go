@@ -1,11 +1,13 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
 	"sort"
 
 	"github.com/DDP-Projekt/DDPLS/documents"
 	"github.com/DDP-Projekt/DDPLS/helper"
+	"github.com/DDP-Projekt/DDPLS/uri"
 	"github.com/DDP-Projekt/Kompilierer/src/ast"
 	"github.com/DDP-Projekt/Kompilierer/src/token"
 
@@ -13,54 +15,86 @@ import (
 	protocol "github.com/tliron/glsp/protocol_3_16"
 )
 
-func CreateTextDocumentSemanticTokensFull(dm *documents.DocumentManager) protocol.TextDocumentSemanticTokensFullFunc {
+func CreateTextDocumentSemanticTokensFull(dm *documents.DocumentManager, cache *SemanticTokensCache) protocol.TextDocumentSemanticTokensFullFunc {
 	return RecoverAnyErr(func(context *glsp.Context, params *protocol.SemanticTokensParams) (*protocol.SemanticTokens, error) {
-		act, ok := dm.Get(params.TextDocument.URI)
-		if !ok {
-			return nil, fmt.Errorf("%s not in document map", params.TextDocument.URI)
-		}
-		path := act.Path
-
-		tokenizer := &semanticTokenizer{
-			tokens:          make([]highlightedToken, 0),
-			file:            path,
-			doc:             act,
-			shouldVisitFunc: nil,
+		docUri, tokens, err := fullSemanticTokens(context, dm, params.TextDocument.URI)
+		if err != nil {
+			return nil, err
 		}
 
-		ast.VisitModule(act.Module, tokenizer)
-
-		tokens := tokenizer.getTokens()
+		resultId, _ := cache.store(docUri, tokens.Data)
+		tokens.ResultID = &resultId
 		return tokens, nil
 	})
 }
 
+// returns the semantic tokens of the whole document
+func fullSemanticTokens(glspContext *glsp.Context, dm *documents.DocumentManager, vscURI string) (uri.URI, *protocol.SemanticTokens, error) {
+	ctx, stop := documentRequestContext(glspContext, dm, vscURI)
+	defer stop()
+	act, err := dm.GetWithContext(ctx, vscURI)
+	if err != nil {
+		return "", nil, cancelledOr(ctx, err)
+	}
+	path := act.Path
+
+	tokenizer := &semanticTokenizer{
+		ctx:             ctx,
+		tokens:          make([]highlightedToken, 0),
+		file:            path,
+		doc:             act,
+		enc:             dm.PositionEncoding(),
+		shouldVisitFunc: nil,
+	}
+
+	ast.VisitModule(act.Module, tokenizer)
+	tokenizer.addLexicalTokens()
+
+	// the tokens would not match the current content
+	if ctx.Err() != nil {
+		return "", nil, errRequestCancelled
+	}
+	return act.Uri, tokenizer.getTokens(), nil
+}
+
 func CreateSemanticTokensRange(dm *documents.DocumentManager) protocol.TextDocumentSemanticTokensRangeFunc {
 	return RecoverAnyErr(func(context *glsp.Context, params *protocol.SemanticTokensRangeParams) (any, error) {
-		act, ok := dm.Get(params.TextDocument.URI)
-		if !ok {
-			return nil, fmt.Errorf("%s not in document map (Range: %v)", params.TextDocument.URI, params.Range)
+		ctx, stop := documentRequestContext(context, dm, params.TextDocument.URI)
+		defer stop()
+		act, err := dm.GetWithContext(ctx, params.TextDocument.URI)
+		if err != nil {
+			return nil, cancelledOr(ctx, fmt.Errorf("%s (Range: %v)", err, params.Range))
 		}
 		path := act.Path
 
+		rang := helper.FromProtocolRange(decodeRange(dm, act, params.Range))
 		tokenizer := &semanticTokenizer{
+			ctx:    ctx,
 			tokens: make([]highlightedToken, 0),
 			file:   path,
 			doc:    act,
+			enc:    dm.PositionEncoding(),
+			rang:   &rang,
+			// nodes that only touch the range might still contain tokens in it
 			shouldVisitFunc: func(node ast.Node) bool {
 				rng := node.GetRange()
-				return helper.IsInRange(rng, params.Range.Start) || helper.IsInRange(rng, params.Range.End)
+				return !rng.End.IsBefore(rang.Start) && !rng.Start.IsBehind(rang.End)
 			},
 		}
 
 		ast.VisitModule(act.Module, tokenizer)
+		tokenizer.addLexicalTokens()
 
-		tokens := tokenizer.getTokens()
-		return tokens, nil
+		// the tokens would not match the current content
+		if ctx.Err() != nil {
+			return nil, errRequestCancelled
+		}
+		return tokenizer.getTokens(), nil
 	})
 }
 
 type highlightedToken struct {
+	rang                 token.Range // the range in the document, only used for filtering and sorting
 	line, column, length int
 	tokenType            protocol.SemanticTokenType
 	modifiers            []protocol.SemanticTokenModifier
@@ -89,9 +123,12 @@ func (t *highlightedToken) serialize(previous highlightedToken) []protocol.UInte
 }
 
 type semanticTokenizer struct {
+	ctx             context.Context
 	file            string
 	tokens          []highlightedToken
 	doc             *documents.DocumentState
+	enc             documents.PositionEncoding // the encoding of columns and lengths
+	rang            *token.Range               // if not nil, only tokens overlapping it are added
 	shouldVisitFunc func(node ast.Node) bool
 	vis             ast.FullVisitor
 }
@@ -108,6 +145,9 @@ func (t *semanticTokenizer) SetVisitor(vis ast.FullVisitor) {
 }
 
 func (t *semanticTokenizer) ShouldVisit(node ast.Node) bool {
+	if isCancelled(t.ctx) {
+		return false
+	}
 	if t.shouldVisitFunc != nil {
 		return t.shouldVisitFunc(node)
 	}
@@ -115,8 +155,17 @@ func (t *semanticTokenizer) ShouldVisit(node ast.Node) bool {
 }
 
 func (t *semanticTokenizer) getTokens() *protocol.SemanticTokens {
+	// the visit methods do not add the tokens of a node in source order,
+	// but the deltas must not be negative
+	sort.SliceStable(t.tokens, func(i, j int) bool {
+		return t.tokens[i].rang.Start.IsBefore(t.tokens[j].rang.Start)
+	})
+
 	data := make([]protocol.UInteger, 0, len(t.tokens)*5)
 	for i := range t.tokens {
+		// the first token is relative to the start of the document, even for range requests,
+		// because LSP defines the deltas that way and clients decode range results
+		// just like full results, tokens relative to the start of the range would be misplaced
 		if i == 0 {
 			data = append(data, t.tokens[i].serialize(highlightedToken{line: 1, column: 1})...)
 		} else {
@@ -129,28 +178,35 @@ func (t *semanticTokenizer) getTokens() *protocol.SemanticTokens {
 }
 
 func (t *semanticTokenizer) add(tok highlightedToken) {
+	// nodes without a position in the source, e.g. literals inserted by the parser
+	if tok.length == 0 {
+		return
+	}
+	if t.rang != nil && !(tok.rang.End.IsBehind(t.rang.Start) && tok.rang.Start.IsBefore(t.rang.End)) {
+		return
+	}
 	t.tokens = append(t.tokens, tok)
 }
 
 func (t *semanticTokenizer) VisitVarDecl(d *ast.VarDecl) ast.VisitResult {
-	t.add(newHightlightedToken(d.TypeRange, t.doc, protocol.SemanticTokenTypeType, nil))
-	t.add(newHightlightedToken(token.NewRange(&d.NameTok, &d.NameTok), t.doc, protocol.SemanticTokenTypeVariable, nil))
+	t.add(newHightlightedToken(d.TypeRange, t.doc, t.enc, protocol.SemanticTokenTypeType, nil))
+	t.add(newHightlightedToken(token.NewRange(&d.NameTok, &d.NameTok), t.doc, t.enc, protocol.SemanticTokenTypeVariable, nil))
 	return ast.VisitRecurse
 }
 
 func (t *semanticTokenizer) VisitFuncDecl(d *ast.FuncDecl) ast.VisitResult {
-	t.add(newHightlightedToken(token.NewRange(&d.NameTok, &d.NameTok), t.doc, protocol.SemanticTokenTypeVariable, nil))
+	t.add(newHightlightedToken(token.NewRange(&d.NameTok, &d.NameTok), t.doc, t.enc, protocol.SemanticTokenTypeVariable, nil))
 	for i := range d.Parameters {
 		name := &d.Parameters[i].Name
-		t.add(newHightlightedToken(token.NewRange(name, name), t.doc, protocol.SemanticTokenTypeParameter, nil))
+		t.add(newHightlightedToken(token.NewRange(name, name), t.doc, t.enc, protocol.SemanticTokenTypeParameter, nil))
 	}
 	for i := range d.Parameters {
 		typeRange := d.Parameters[i].TypeRange
-		t.add(newHightlightedToken(typeRange, t.doc, protocol.SemanticTokenTypeType, nil))
+		t.add(newHightlightedToken(typeRange, t.doc, t.enc, protocol.SemanticTokenTypeType, nil))
 	}
-	t.add(newHightlightedToken(d.ReturnTypeRange, t.doc, protocol.SemanticTokenTypeType, nil))
+	t.add(newHightlightedToken(d.ReturnTypeRange, t.doc, t.enc, protocol.SemanticTokenTypeType, nil))
 
-	if instantiation := getRandomGenericInstantiation(d); instantiation != nil {
+	if instantiation := getRandomGenericInstantiation(t.doc.Instantiations, d); instantiation != nil {
 		t.vis.VisitFuncDecl(instantiation)
 		return ast.VisitSkipChildren
 	}
@@ -165,44 +221,44 @@ func (t *semanticTokenizer) VisitStructDecl(d *ast.StructDecl) ast.VisitResult {
 			ast.VisitNode(t, field, nil)
 		}
 	}
-	t.add(newHightlightedToken(token.NewRange(&d.NameTok, &d.NameTok), t.doc, protocol.SemanticTokenTypeClass, nil))
+	t.add(newHightlightedToken(token.NewRange(&d.NameTok, &d.NameTok), t.doc, t.enc, protocol.SemanticTokenTypeClass, nil))
 	return ast.VisitSkipChildren
 }
 
 func (t *semanticTokenizer) VisitTypeAliasDecl(d *ast.TypeAliasDecl) ast.VisitResult {
-	t.add(newHightlightedToken(d.UnderlyingRange, t.doc, protocol.SemanticTokenTypeClass, nil))
-	t.add(newHightlightedToken(d.NameTok.Range, t.doc, protocol.SemanticTokenTypeClass, nil))
+	t.add(newHightlightedToken(d.UnderlyingRange, t.doc, t.enc, protocol.SemanticTokenTypeClass, nil))
+	t.add(newHightlightedToken(d.NameTok.Range, t.doc, t.enc, protocol.SemanticTokenTypeClass, nil))
 	return ast.VisitRecurse
 }
 
 func (t *semanticTokenizer) VisitTypeDefDecl(d *ast.TypeDefDecl) ast.VisitResult {
-	t.add(newHightlightedToken(d.NameTok.Range, t.doc, protocol.SemanticTokenTypeClass, nil))
-	t.add(newHightlightedToken(d.UnderlyingRange, t.doc, protocol.SemanticTokenTypeClass, nil))
+	t.add(newHightlightedToken(d.NameTok.Range, t.doc, t.enc, protocol.SemanticTokenTypeClass, nil))
+	t.add(newHightlightedToken(d.UnderlyingRange, t.doc, t.enc, protocol.SemanticTokenTypeClass, nil))
 	return ast.VisitRecurse
 }
 
 func (t *semanticTokenizer) VisitIdent(e *ast.Ident) ast.VisitResult {
-	t.add(newHightlightedToken(e.GetRange(), t.doc, protocol.SemanticTokenTypeVariable, nil))
+	t.add(newHightlightedToken(e.GetRange(), t.doc, t.enc, protocol.SemanticTokenTypeVariable, nil))
 	return ast.VisitRecurse
 }
 
 func (t *semanticTokenizer) VisitIntLit(e *ast.IntLit) ast.VisitResult {
-	t.add(newHightlightedToken(e.GetRange(), t.doc, protocol.SemanticTokenTypeNumber, nil))
+	t.add(newHightlightedToken(e.GetRange(), t.doc, t.enc, protocol.SemanticTokenTypeNumber, nil))
 	return ast.VisitRecurse
 }
 
 func (t *semanticTokenizer) VisitFloatLit(e *ast.FloatLit) ast.VisitResult {
-	t.add(newHightlightedToken(e.GetRange(), t.doc, protocol.SemanticTokenTypeNumber, nil))
+	t.add(newHightlightedToken(e.GetRange(), t.doc, t.enc, protocol.SemanticTokenTypeNumber, nil))
 	return ast.VisitRecurse
 }
 
 func (t *semanticTokenizer) VisitCharLit(e *ast.CharLit) ast.VisitResult {
-	// t.add(newHightlightedToken(e.GetRange(), t.doc, protocol.SemanticTokenTypeString, nil))
+	// t.add(newHightlightedToken(e.GetRange(), t.doc, t.enc, protocol.SemanticTokenTypeString, nil))
 	return ast.VisitRecurse
 }
 
 func (t *semanticTokenizer) VisitStringLit(e *ast.StringLit) ast.VisitResult {
-	// t.add(newHightlightedToken(e.GetRange(), t.doc, protocol.SemanticTokenTypeString, nil))
+	// t.add(newHightlightedToken(e.GetRange(), t.doc, t.enc, protocol.SemanticTokenTypeString, nil))
 	return ast.VisitRecurse
 }
 
@@ -228,17 +284,17 @@ func (t *semanticTokenizer) VisitFuncCall(e *ast.FuncCall) ast.VisitResult {
 			argRange := arg.GetRange()
 			cutRange := helper.CutRangeOut(rang, argRange)
 			if helper.GetRangeLength(cutRange[0], t.doc) != 0 {
-				t.add(newHightlightedToken(cutRange[0], t.doc, protocol.SemanticTokenTypeFunction, nil))
+				t.add(newHightlightedToken(cutRange[0], t.doc, t.enc, protocol.SemanticTokenTypeFunction, nil))
 			}
 			ast.VisitNode(t, arg, nil)
 			rang = token.Range{Start: cutRange[1].Start, End: rang.End}
 
 			if i == len(e.Args)-1 && helper.GetRangeLength(cutRange[1], t.doc) != 0 {
-				t.add(newHightlightedToken(cutRange[1], t.doc, protocol.SemanticTokenTypeFunction, nil))
+				t.add(newHightlightedToken(cutRange[1], t.doc, t.enc, protocol.SemanticTokenTypeFunction, nil))
 			}
 		}
 	} else {
-		t.add(newHightlightedToken(rang, t.doc, protocol.SemanticTokenTypeFunction, nil))
+		t.add(newHightlightedToken(rang, t.doc, t.enc, protocol.SemanticTokenTypeFunction, nil))
 	}
 	return ast.VisitSkipChildren
 }
@@ -265,34 +321,40 @@ func (t *semanticTokenizer) VisitStructLiteral(e *ast.StructLiteral) ast.VisitRe
 			argRange := arg.GetRange()
 			cutRange := helper.CutRangeOut(rang, argRange)
 			if helper.GetRangeLength(cutRange[0], t.doc) != 0 {
-				t.add(newHightlightedToken(cutRange[0], t.doc, protocol.SemanticTokenTypeFunction, nil))
+				t.add(newHightlightedToken(cutRange[0], t.doc, t.enc, protocol.SemanticTokenTypeFunction, nil))
 			}
 			ast.VisitNode(t, arg, nil)
 			rang = token.Range{Start: cutRange[1].Start, End: rang.End}
 
 			if i == len(e.Args)-1 && helper.GetRangeLength(cutRange[1], t.doc) != 0 {
-				t.add(newHightlightedToken(cutRange[1], t.doc, protocol.SemanticTokenTypeFunction, nil))
+				t.add(newHightlightedToken(cutRange[1], t.doc, t.enc, protocol.SemanticTokenTypeFunction, nil))
 			}
 		}
 	} else {
-		t.add(newHightlightedToken(rang, t.doc, protocol.SemanticTokenTypeFunction, nil))
+		t.add(newHightlightedToken(rang, t.doc, t.enc, protocol.SemanticTokenTypeFunction, nil))
 	}
 	return ast.VisitSkipChildren
 }
 
 func (t *semanticTokenizer) VisitImportStmt(e *ast.ImportStmt) ast.VisitResult {
-	t.add(newHightlightedToken(e.FileName.Range, t.doc, protocol.SemanticTokenTypeString, nil))
+	t.add(newHightlightedToken(e.FileName.Range, t.doc, t.enc, protocol.SemanticTokenTypeString, nil))
 	return ast.VisitRecurse
 }
 
-func newHightlightedToken(rang token.Range, doc *documents.DocumentState, tokType protocol.SemanticTokenType, modifiers []protocol.SemanticTokenModifier) highlightedToken {
+func newHightlightedToken(rang token.Range, doc *documents.DocumentState, enc documents.PositionEncoding, tokType protocol.SemanticTokenType, modifiers []protocol.SemanticTokenModifier) highlightedToken {
 	if modifiers == nil {
 		modifiers = make([]protocol.SemanticTokenModifier, 0)
 	}
+	column, length := int(rang.Start.Column), helper.GetRangeLength(rang, doc)
+	if enc != documents.PositionEncodingUTF32 {
+		column = int(doc.Lines.ToProtocolPosition(rang.Start, enc).Character) + 1
+		length = doc.Lines.Length(rang, enc)
+	}
 	return highlightedToken{
+		rang:      rang,
 		line:      int(rang.Start.Line),
-		column:    int(rang.Start.Column),
-		length:    helper.GetRangeLength(rang, doc),
+		column:    column,
+		length:    length,
 		tokenType: tokType,
 		modifiers: modifiers,
 	}
@@ -373,20 +435,10 @@ func bitFlag(modifier protocol.SemanticTokenModifier) protocol.UInteger {
 	return 0
 }
 
-func getRandomGenericInstantiation(d *ast.FuncDecl) *ast.FuncDecl {
-	if !ast.IsGeneric(d) || len(d.Generic.Instantiations) == 0 {
+// returns an instantiation of d, preferably one from the module of d
+func getRandomGenericInstantiation(instantiations documents.Instantiations, d *ast.FuncDecl) *ast.FuncDecl {
+	if !ast.IsGeneric(d) || len(instantiations[d]) == 0 {
 		return nil
 	}
-
-	if instantiations, ok := d.Generic.Instantiations[d.Mod]; ok && len(instantiations) > 0 {
-		return instantiations[0]
-	}
-
-	for _, inst := range d.Generic.Instantiations {
-		if len(inst) > 0 {
-			return inst[0]
-		}
-	}
-
-	return nil
+	return instantiations[d][0]
 }
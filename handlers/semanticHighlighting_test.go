@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"slices"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/DDP-Projekt/DDPLS/documents"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+const semanticTokensTestSource = `[ein Kommentar
+über zwei Zeilen 😀]
+Die Zahl zähler ist 5.
+
+Die Funktion addiere mit den Parametern a und b vom Typ Zahl und Zahl, gibt eine Zahl zurück, macht:
+	Gib a plus b zurück.
+Und kann so benutzt werden:
+	"die Summe von <a> und <b>"
+
+Der Text t ist "Grüße" verkettet mit "😀". [noch ein Kommentar]
+Wenn zähler gleich die Summe von 1 und 2 ist, dann:
+	zähler ist 3.
+`
+
+// a semantic token with absolute positions
+type absoluteToken struct {
+	line, start, length, tokenType, modifiers protocol.UInteger
+}
+
+func decodeSemanticTokens(data []protocol.UInteger) []absoluteToken {
+	tokens := make([]absoluteToken, 0, len(data)/5)
+	line, start := protocol.UInteger(0), protocol.UInteger(0)
+	for i := 0; i+4 < len(data); i += 5 {
+		if data[i] != 0 {
+			start = 0
+		}
+		line += data[i]
+		start += data[i+1]
+		tokens = append(tokens, absoluteToken{line, start, data[i+2], data[i+3], data[i+4]})
+	}
+	return tokens
+}
+
+func encodeSemanticTokens(tokens []absoluteToken) []protocol.UInteger {
+	data := make([]protocol.UInteger, 0, len(tokens)*5)
+	line, start := protocol.UInteger(0), protocol.UInteger(0)
+	for _, tok := range tokens {
+		if tok.line != line {
+			start = 0
+		}
+		data = append(data, tok.line-line, tok.start-start, tok.length, tok.tokenType, tok.modifiers)
+		line, start = tok.line, tok.start
+	}
+	return data
+}
+
+// the tokens that overlap rang, tokens that only touch it are left out
+func overlappingTokens(tokens []absoluteToken, rang protocol.Range) []absoluteToken {
+	isBefore := func(a, b protocol.Position) bool {
+		return a.Line < b.Line || a.Line == b.Line && a.Character < b.Character
+	}
+	result := make([]absoluteToken, 0)
+	for _, tok := range tokens {
+		start := protocol.Position{Line: tok.line, Character: tok.start}
+		end := protocol.Position{Line: tok.line, Character: tok.start + tok.length}
+		if isBefore(rang.Start, end) && isBefore(start, rang.End) {
+			result = append(result, tok)
+		}
+	}
+	return result
+}
+
+func TestSemanticTokensRange(t *testing.T) {
+	const docUri = "file:///semantic_tokens_test.ddp"
+	for _, enc := range []documents.PositionEncoding{documents.PositionEncodingUTF8, documents.PositionEncodingUTF16, documents.PositionEncodingUTF32} {
+		dm := documents.NewDocumentManager()
+		dm.SetPositionEncoding(enc)
+		if err := dm.AddAndParse(docUri, 1, semanticTokensTestSource); err != nil {
+			t.Fatal(err)
+		}
+
+		_, full, err := fullSemanticTokens(&glsp.Context{}, dm, docUri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fullTokens := decodeSemanticTokens(full.Data)
+		if len(fullTokens) == 0 {
+			t.Fatalf("%s: no semantic tokens", enc)
+		}
+
+		// the boundaries of every token and the position behind its first character
+		// are used as start and end of a range, so that ranges start and end inside, at and between tokens
+		lines := documents.NewLineIndex(semanticTokensTestSource)
+		positions := []protocol.Position{{Line: 0, Character: 0}, {Line: 100, Character: 0}}
+		for _, tok := range fullTokens {
+			start := protocol.Position{Line: tok.line, Character: tok.start}
+			_, size := utf8.DecodeRuneInString(semanticTokensTestSource[lines.ProtocolOffset(start, enc):])
+			positions = append(positions,
+				start,
+				lines.ProtocolPosition(lines.ProtocolOffset(start, enc)+size, enc),
+				protocol.Position{Line: tok.line, Character: tok.start + tok.length},
+			)
+		}
+
+		rangeHandler := CreateSemanticTokensRange(dm)
+		for _, start := range positions {
+			for _, end := range positions {
+				if end.Line < start.Line || end.Line == start.Line && end.Character <= start.Character {
+					continue
+				}
+
+				rang := protocol.Range{Start: start, End: end}
+				result, err := rangeHandler(&glsp.Context{}, &protocol.SemanticTokensRangeParams{
+					TextDocument: protocol.TextDocumentIdentifier{URI: docUri},
+					Range:        rang,
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				want := encodeSemanticTokens(overlappingTokens(fullTokens, rang))
+				if got := result.(*protocol.SemanticTokens).Data; !slices.Equal(got, want) {
+					t.Fatalf("%s: tokens in %v:\ngot  %v\nwant %v", enc, rang, got, want)
+				}
+			}
+		}
+	}
+}
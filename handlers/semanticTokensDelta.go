@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/DDP-Projekt/DDPLS/documents"
+	"github.com/DDP-Projekt/DDPLS/uri"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// the last semantic tokens sent per document
+// deltas are computed against them, so that only the changed tokens are sent
+type SemanticTokensCache struct {
+	mu     sync.Mutex
+	lastId uint64
+	tokens map[uri.URI]cachedSemanticTokens
+}
+
+type cachedSemanticTokens struct {
+	resultId string
+	data     []protocol.UInteger
+}
+
+func NewSemanticTokensCache() *SemanticTokensCache {
+	return &SemanticTokensCache{
+		tokens: make(map[uri.URI]cachedSemanticTokens),
+	}
+}
+
+// stores data as the last tokens of docUri and returns their result id
+// returns the cached tokens that were replaced
+func (c *SemanticTokensCache) store(docUri uri.URI, data []protocol.UInteger) (resultId string, previous cachedSemanticTokens) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lastId++
+	resultId = strconv.FormatUint(c.lastId, 10)
+	previous = c.tokens[docUri]
+	c.tokens[docUri] = cachedSemanticTokens{resultId: resultId, data: data}
+	return resultId, previous
+}
+
+// removes the cached tokens of a closed document
+func (c *SemanticTokensCache) Delete(vscURI string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.tokens, uri.FromURI(vscURI))
+}
+
+func CreateTextDocumentSemanticTokensFullDelta(dm *documents.DocumentManager, cache *SemanticTokensCache) protocol.TextDocumentSemanticTokensFullDeltaFunc {
+	return RecoverAnyErr(func(context *glsp.Context, params *protocol.SemanticTokensDeltaParams) (any, error) {
+		docUri, tokens, err := fullSemanticTokens(context, dm, params.TextDocument.URI)
+		if err != nil {
+			return nil, err
+		}
+
+		resultId, previous := cache.store(docUri, tokens.Data)
+		// the client might refer to tokens that were already replaced
+		// by a full request, in which case it needs all tokens again
+		if previous.resultId == "" || previous.resultId != params.PreviousResultID {
+			tokens.ResultID = &resultId
+			return tokens, nil
+		}
+
+		return &protocol.SemanticTokensDelta{
+			ResultID: &resultId,
+			Edits:    semanticTokensEdits(previous.data, tokens.Data),
+		}, nil
+	})
+}
+
+// returns the edits that turn old into new
+// the changed part between the common prefix and suffix is replaced by a single edit
+func semanticTokensEdits(old, new []protocol.UInteger) []protocol.SemanticTokensEdit {
+	prefix := 0
+	for prefix < len(old) && prefix < len(new) && old[prefix] == new[prefix] {
+		prefix++
+	}
+
+	suffix := 0
+	for suffix < len(old)-prefix && suffix < len(new)-prefix && old[len(old)-1-suffix] == new[len(new)-1-suffix] {
+		suffix++
+	}
+
+	deleteCount := len(old) - prefix - suffix
+	data := new[prefix : len(new)-suffix]
+	if deleteCount == 0 && len(data) == 0 {
+		return make([]protocol.SemanticTokensEdit, 0)
+	}
+
+	return []protocol.SemanticTokensEdit{{
+		Start:       protocol.UInteger(prefix),
+		DeleteCount: protocol.UInteger(deleteCount),
+		Data:        data,
+	}}
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/DDP-Projekt/DDPLS/documents"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// applies the edits to data in order, as the client does
+func applySemanticTokensEdits(data []protocol.UInteger, edits []protocol.SemanticTokensEdit) []protocol.UInteger {
+	result := slices.Clone(data)
+	for _, edit := range edits {
+		result = slices.Replace(result, int(edit.Start), int(edit.Start+edit.DeleteCount), edit.Data...)
+	}
+	return result
+}
+
+func TestSemanticTokensEdits(t *testing.T) {
+	tests := []struct {
+		name      string
+		old, new  []protocol.UInteger
+		wantEdits int
+	}{
+		{"both empty", nil, nil, 0},
+		{"empty old", nil, []protocol.UInteger{0, 1, 2, 3, 0}, 1},
+		{"empty new", []protocol.UInteger{0, 1, 2, 3, 0}, nil, 1},
+		{"unchanged", []protocol.UInteger{0, 1, 2, 3, 0, 1, 0, 4, 1, 0}, []protocol.UInteger{0, 1, 2, 3, 0, 1, 0, 4, 1, 0}, 0},
+		{"changed middle", []protocol.UInteger{0, 1, 2, 3, 0, 1, 0, 4, 1, 0}, []protocol.UInteger{0, 1, 2, 3, 0, 2, 0, 4, 1, 0}, 1},
+		{"inserted", []protocol.UInteger{0, 1, 2, 3, 0}, []protocol.UInteger{0, 1, 2, 3, 0, 1, 0, 4, 1, 0}, 1},
+		{"removed", []protocol.UInteger{0, 1, 2, 3, 0, 1, 0, 4, 1, 0}, []protocol.UInteger{1, 0, 4, 1, 0}, 1},
+		// prefix and suffix would overlap if the suffix was not limited to what is left after the prefix
+		{"repeated element inserted", []protocol.UInteger{1, 1}, []protocol.UInteger{1, 1, 1}, 1},
+		{"repeated element removed", []protocol.UInteger{1, 1, 1}, []protocol.UInteger{1, 1}, 1},
+		{"shared elements", []protocol.UInteger{1, 2, 1}, []protocol.UInteger{1}, 1},
+		{"shared elements reversed", []protocol.UInteger{1}, []protocol.UInteger{1, 2, 1}, 1},
+	}
+
+	for _, test := range tests {
+		edits := semanticTokensEdits(test.old, test.new)
+		if len(edits) != test.wantEdits {
+			t.Errorf("%s: got %d edits, want %d", test.name, len(edits), test.wantEdits)
+		}
+		for _, edit := range edits {
+			if int(edit.Start+edit.DeleteCount) > len(test.old) {
+				t.Errorf("%s: edit %v is outside of the old tokens", test.name, edit)
+			}
+		}
+		if got := applySemanticTokensEdits(test.old, edits); !slices.Equal(got, test.new) {
+			t.Errorf("%s: applying %v gives %v, want %v", test.name, edits, got, test.new)
+		}
+	}
+}
+
+func TestSemanticTokensFullDelta(t *testing.T) {
+	const docUri = "file:///semantic_tokens_delta_test.ddp"
+	dm := documents.NewDocumentManager()
+	if err := dm.AddAndParse(docUri, 1, semanticTokensTestSource); err != nil {
+		t.Fatal(err)
+	}
+	cache := NewSemanticTokensCache()
+	delta := func(previousResultId string) any {
+		result, err := CreateTextDocumentSemanticTokensFullDelta(dm, cache)(&glsp.Context{}, &protocol.SemanticTokensDeltaParams{
+			TextDocument:     protocol.TextDocumentIdentifier{URI: docUri},
+			PreviousResultID: previousResultId,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	// there are no previous tokens yet
+	first, ok := delta("").(*protocol.SemanticTokens)
+	if !ok || first.ResultID == nil {
+		t.Fatalf("got %T, want full tokens with a result id", first)
+	}
+
+	unchanged, ok := delta(*first.ResultID).(*protocol.SemanticTokensDelta)
+	if !ok {
+		t.Fatal("got full tokens, want a delta")
+	}
+	if len(unchanged.Edits) != 0 {
+		t.Errorf("got %d edits for an unchanged document, want 0", len(unchanged.Edits))
+	}
+
+	if err := dm.ApplyChanges(docUri, 2, []documents.ContentChange{{Text: "Die Zahl x ist 1.\n" + semanticTokensTestSource}}); err != nil {
+		t.Fatal(err)
+	}
+	changed, ok := delta(*unchanged.ResultID).(*protocol.SemanticTokensDelta)
+	if !ok {
+		t.Fatal("got full tokens, want a delta")
+	}
+	_, full, err := fullSemanticTokens(&glsp.Context{}, dm, docUri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := applySemanticTokensEdits(first.Data, changed.Edits); !slices.Equal(got, full.Data) {
+		t.Errorf("applying the delta gives\n%v\nwant\n%v", got, full.Data)
+	}
+
+	// the client refers to tokens that were already replaced
+	if _, ok := delta(*first.ResultID).(*protocol.SemanticTokens); !ok {
+		t.Error("got a delta for an outdated result id, want full tokens")
+	}
+}
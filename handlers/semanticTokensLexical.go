@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"sort"
+
+	"github.com/DDP-Projekt/Kompilierer/src/scanner"
+	"github.com/DDP-Projekt/Kompilierer/src/token"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// the natural-language operators
+var operatorTokens = map[token.TokenType]struct{}{
+	token.PLUS:        {},
+	token.MINUS:       {},
+	token.MAL:         {},
+	token.DURCH:       {},
+	token.MODULO:      {},
+	token.HOCH:        {},
+	token.WURZEL:      {},
+	token.BETRAG:      {},
+	token.UND:         {},
+	token.ODER:        {},
+	token.ENTWEDER:    {},
+	token.NICHT:       {},
+	token.GLEICH:      {},
+	token.UNGLEICH:    {},
+	token.KLEINER:     {},
+	token.GRÖßER:      {},
+	token.ZWISCHEN:    {},
+	token.NEGATE:      {},
+	token.LINKS:       {},
+	token.RECHTS:      {},
+	token.GRÖßE:       {},
+	token.LÄNGE:       {},
+	token.KONTRA:      {},
+	token.VERKETTET:   {},
+	token.LOGARITHMUS: {},
+	token.FALLS:       {},
+	token.ANSONSTEN:   {},
+	token.LOGISCH:     {},
+	token.VERSCHOBEN:  {},
+	token.VONBIS:      {},
+	token.ZUR:         {}, // 'zur Basis' of 'Logarithmus von x zur Basis y'
+}
+
+// words that are part of the operator before them, e.g. 'mit' in 'verkettet mit'
+// on their own they are keywords, e.g. 'mit' in 'mit Schrittgröße'
+var operatorContinuations = map[token.TokenType][]token.TokenType{
+	token.VERKETTET:   {token.MIT},
+	token.KLEINER:     {token.ALS},
+	token.GRÖßER:      {token.ALS},
+	token.WURZEL:      {token.VON},
+	token.BETRAG:      {token.VON},
+	token.GRÖßE:       {token.VON},
+	token.LÄNGE:       {token.VON},
+	token.LOGARITHMUS: {token.VON},
+	token.ZUR:         {token.BASIS},
+}
+
+// tokens that start a comparison which a following 'ist' closes,
+// e.g. 'gleich' in 'wenn a gleich b ist' or 'eine' in 'wenn a eine Zahl ist'
+var comparisonTokens = map[token.TokenType]struct{}{
+	token.GLEICH:   {},
+	token.UNGLEICH: {},
+	token.KLEINER:  {},
+	token.GRÖßER:   {},
+	token.ZWISCHEN: {},
+	token.EIN:      {},
+	token.EINE:     {},
+	token.KEIN:     {},
+	token.KEINE:    {},
+}
+
+// classifies the tokens of the scanner in order
+// only keywords, articles, operators and comments are classified,
+// literals, names and types are left to the tokens of the ast
+type lexicalClassifier struct {
+	previous   token.TokenType // the last token that is not a comment
+	comparison bool            // whether the current comparison is still missing its 'ist'
+}
+
+// returns the type of tok, next is the token behind it that is not a comment
+// returns false for tokens that are not highlighted, like punctuation
+func (c *lexicalClassifier) tokenType(tok, next token.TokenType) (protocol.SemanticTokenType, bool) {
+	if tok == token.COMMENT {
+		return protocol.SemanticTokenTypeComment, true
+	}
+	previous := c.previous
+	c.previous = tok
+
+	switch tok {
+	case token.DOT, token.COLON:
+		c.comparison = false
+	case token.IST:
+		// 'ist' is part of a comparison as in 'a ist gleich b' or 'a gleich b ist'
+		// otherwise it is the keyword of a declaration or assignment as in 'Die Zahl a ist 1'
+		_, startsComparison := comparisonTokens[next]
+		if startsComparison || c.comparison {
+			c.comparison = false
+			return protocol.SemanticTokenTypeOperator, true
+		}
+		return protocol.SemanticTokenTypeKeyword, true
+	}
+	if _, ok := comparisonTokens[tok]; ok && previous != token.IST {
+		c.comparison = true
+	}
+
+	if _, ok := operatorTokens[tok]; ok {
+		return protocol.SemanticTokenTypeOperator, true
+	}
+	for _, continuation := range operatorContinuations[previous] {
+		if tok == continuation {
+			return protocol.SemanticTokenTypeOperator, true
+		}
+	}
+	switch tok {
+	case token.ILLEGAL, token.EOF, token.IDENTIFIER, token.ALIAS_PARAMETER, token.SYMBOL,
+		token.INT, token.FLOAT, token.STRING, token.CHAR,
+		token.ZAHL, token.ZAHLEN, token.KOMMAZAHL, token.KOMMAZAHLEN, token.BYTE, token.WAHRHEITSWERT,
+		token.BUCHSTABE, token.BUCHSTABEN, token.TEXT, token.LISTE, token.LISTEN, token.VARIABLE, token.VARIABLEN,
+		token.DOT, token.COMMA, token.COLON, token.LPAREN, token.RPAREN, token.ELIPSIS:
+		return "", false
+	}
+	// keywords and articles
+	return protocol.SemanticTokenTypeKeyword, true
+}
+
+// adds the tokens of the scanner that are not covered by the tokens of the ast
+// so that keywords, operators and comments are highlighted as well,
+// even if the document could not be parsed
+func (t *semanticTokenizer) addLexicalTokens() {
+	tokens, err := scanner.Scan(scanner.Options{
+		FileName:    t.file,
+		Source:      []byte(t.doc.Content),
+		ScannerMode: scanner.ModeNone,
+	})
+	if err != nil {
+		return
+	}
+
+	// the tokens of the ast take precedence, e.g. the words of a function alias
+	astTokens := t.tokens
+	sort.SliceStable(astTokens, func(i, j int) bool {
+		return astTokens[i].rang.Start.IsBefore(astTokens[j].rang.Start)
+	})
+	// maxEnd[i] is the end of the ast token up to i that ends last
+	maxEnd := make([]token.Position, len(astTokens))
+	for i, tok := range astTokens {
+		maxEnd[i] = tok.rang.End
+		if i > 0 && maxEnd[i-1].IsBehind(tok.rang.End) {
+			maxEnd[i] = maxEnd[i-1]
+		}
+	}
+	covered := func(rang token.Range) bool {
+		// the first ast token that starts behind rang
+		i := sort.Search(len(astTokens), func(i int) bool {
+			return !astTokens[i].rang.Start.IsBefore(rang.End)
+		})
+		return i > 0 && maxEnd[i-1].IsBehind(rang.Start)
+	}
+
+	classifier := lexicalClassifier{previous: token.ILLEGAL}
+	for i := range tokens {
+		tok := &tokens[i]
+		if isCancelled(t.ctx) {
+			return
+		}
+
+		next := token.EOF
+		for j := i + 1; j < len(tokens); j++ {
+			if tokens[j].Type != token.COMMENT {
+				next = tokens[j].Type
+				break
+			}
+		}
+		tokType, ok := classifier.tokenType(tok.Type, next)
+		if !ok || covered(tok.Range) {
+			continue
+		}
+
+		// clients can't highlight tokens across lines, e.g. of multiline comments
+		for line := tok.Range.Start.Line; line <= tok.Range.End.Line; line++ {
+			rang := tok.Range
+			if line > tok.Range.Start.Line {
+				rang.Start = token.Position{Line: line, Column: 1}
+			}
+			if line < tok.Range.End.Line {
+				// the position of the line break
+				rang.End = t.doc.Lines.Position(t.doc.Lines.Offset(token.Position{Line: line + 1, Column: 1}) - 1)
+			}
+			t.add(newHightlightedToken(rang, t.doc, t.enc, tokType, nil))
+		}
+	}
+}
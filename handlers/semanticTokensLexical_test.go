@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/DDP-Projekt/Kompilierer/src/scanner"
+	"github.com/DDP-Projekt/Kompilierer/src/token"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func TestLexicalClassifier(t *testing.T) {
+	tests := []struct {
+		source string
+		want   []protocol.SemanticTokenType // the types of the tokens that are highlighted
+	}{
+		{"Die Zahl z ist 1.", []protocol.SemanticTokenType{"keyword", "keyword"}},
+		{"z ist 2.", []protocol.SemanticTokenType{"keyword"}},
+		{"Wenn z gleich 2 ist, dann:", []protocol.SemanticTokenType{"keyword", "operator", "operator", "keyword"}},
+		{"Wenn z ist gleich 2, dann:", []protocol.SemanticTokenType{"keyword", "operator", "operator", "keyword"}},
+		{"Wenn z kleiner als 2 ist, dann:", []protocol.SemanticTokenType{"keyword", "operator", "operator", "operator", "keyword"}},
+		{"Wenn z eine Zahl ist, dann:", []protocol.SemanticTokenType{"keyword", "keyword", "operator", "keyword"}},
+		{"Der Text t ist \"a\" verkettet mit \"b\". [Kommentar]", []protocol.SemanticTokenType{"keyword", "keyword", "operator", "operator", "comment"}},
+		{"Die Zahl a ist 1. Wenn a gleich 1 ist, dann: a ist 2.", []protocol.SemanticTokenType{"keyword", "keyword", "keyword", "operator", "operator", "keyword", "keyword"}},
+	}
+	for _, test := range tests {
+		tokens, err := scanner.Scan(scanner.Options{
+			FileName:    "test.ddp",
+			Source:      []byte(test.source),
+			ScannerMode: scanner.ModeNone,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		classifier := lexicalClassifier{previous: token.ILLEGAL}
+		got := make([]protocol.SemanticTokenType, 0)
+		for i, tok := range tokens {
+			next := token.EOF
+			if i+1 < len(tokens) {
+				next = tokens[i+1].Type
+			}
+			if tokType, ok := classifier.tokenType(tok.Type, next); ok {
+				got = append(got, tokType)
+			}
+		}
+
+		if !slices.Equal(got, test.want) {
+			t.Errorf("%q: got %v, want %v", test.source, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,369 @@
+package handlers
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/DDP-Projekt/DDPLS/documents"
+	"github.com/DDP-Projekt/DDPLS/helper"
+	"github.com/DDP-Projekt/Kompilierer/src/ast"
+	"github.com/DDP-Projekt/Kompilierer/src/ddptypes"
+	"github.com/DDP-Projekt/Kompilierer/src/scanner"
+	"github.com/DDP-Projekt/Kompilierer/src/token"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func CreateTextDocumentSignatureHelp(dm *documents.DocumentManager) protocol.TextDocumentSignatureHelpFunc {
+	return RecoverAnyErr(func(context *glsp.Context, params *protocol.SignatureHelpParams) (*protocol.SignatureHelp, error) {
+		doc, ok := dm.Get(params.TextDocument.URI)
+		if !ok {
+			return nil, fmt.Errorf("%s not in document map", params.TextDocument.URI)
+		}
+
+		pos := decodePosition(dm, doc, params.Position)
+		callVisitor := &signatureVisitor{pos: pos}
+		ast.VisitModule(doc.Module, callVisitor)
+
+		// the call at the cursor was parsed, so the ast knows the function and its arguments
+		if call := callVisitor.call; call != nil {
+			alias, active := callAlias(call, pos)
+			if alias == nil {
+				return nil, nil
+			}
+			return &protocol.SignatureHelp{
+				Signatures:      []protocol.SignatureInformation{aliasToSignature(alias, aliasWithoutEOF(alias), active)},
+				ActiveSignature: ptr(protocol.UInteger(0)),
+			}, nil
+		}
+
+		// otherwise the call is not finished yet and could not be parsed,
+		// in which case only the scanner can tell which alias is being typed
+		errorStart, ok := callVisitor.errorStart, callVisitor.inError
+		for _, err := range doc.LatestErrors {
+			if !helper.FromProtocolPosition(pos).IsBefore(err.Range.Start) && (!ok || errorStart.IsBefore(err.Range.Start)) {
+				errorStart, ok = err.Range.Start, true
+			}
+		}
+		if !ok {
+			return nil, nil
+		}
+
+		index := doc.Lines.ProtocolOffset(params.Position, dm.PositionEncoding())
+		typed, partial := currentSentence(doc.Content[:index])
+		// the error belongs to an earlier sentence
+		if len(typed) == 0 || typed[0].Range.Start.IsBehind(errorStart) {
+			return nil, nil
+		}
+
+		// the symbol table at the cursor, it also contains the aliases
+		// if the current statement could not be parsed
+		visitor := &tableVisitor{
+			Table:     doc.Module.Ast.Symbols,
+			tempTable: doc.Module.Ast.Symbols,
+			pos:       pos,
+		}
+		ast.VisitModule(doc.Module, visitor)
+
+		aliases := make([]ast.Alias, 0, 16)
+		seen := make(map[ast.Alias]struct{}, 16)
+		for table := visitor.Table; table != nil; table = table.Enclosing() {
+			basicTable, ok := table.(*ast.BasicSymbolTable)
+			if !ok {
+				continue
+			}
+
+			for name := range basicTable.Declarations {
+				decl, _, _ := table.LookupDecl(name)
+				switch decl := decl.(type) {
+				case *ast.FuncDecl:
+					for _, alias := range decl.Aliases {
+						if _, ok := seen[alias]; !ok {
+							seen[alias] = struct{}{}
+							aliases = append(aliases, alias)
+						}
+					}
+				case *ast.StructDecl:
+					for _, alias := range decl.Aliases {
+						if _, ok := seen[alias]; !ok {
+							seen[alias] = struct{}{}
+							aliases = append(aliases, alias)
+						}
+					}
+				}
+			}
+		}
+
+		// try every start of a (nested) call, beginning with the innermost one
+		signatures := make([]protocol.SignatureInformation, 0, 4)
+		for start := len(typed) - 1; start >= 0; start-- {
+			// we need at least one complete token to be sure
+			if start == len(typed)-1 && partial {
+				continue
+			}
+
+			for _, alias := range aliases {
+				aliasTokens := aliasWithoutEOF(alias)
+				active, ok := matchAliasPrefix(aliasTokens, typed[start:], partial)
+				if !ok {
+					continue
+				}
+				signatures = append(signatures, aliasToSignature(alias, aliasTokens, active))
+			}
+		}
+
+		if len(signatures) == 0 {
+			return nil, nil
+		}
+
+		return &protocol.SignatureHelp{
+			Signatures:      signatures,
+			ActiveSignature: ptr(protocol.UInteger(0)),
+		}, nil
+	})
+}
+
+// finds the innermost function call at pos
+// and the start of the last node before pos that could not be parsed
+type signatureVisitor struct {
+	pos        protocol.Position
+	call       *ast.FuncCall
+	errorStart token.Position
+	inError    bool
+}
+
+var (
+	_ ast.Visitor            = (*signatureVisitor)(nil)
+	_ ast.ConditionalVisitor = (*signatureVisitor)(nil)
+	_ ast.FuncCallVisitor    = (*signatureVisitor)(nil)
+	_ ast.BadDeclVisitor     = (*signatureVisitor)(nil)
+	_ ast.BadStmtVisitor     = (*signatureVisitor)(nil)
+	_ ast.BadExprVisitor     = (*signatureVisitor)(nil)
+)
+
+func (*signatureVisitor) Visitor() {}
+
+func (v *signatureVisitor) ShouldVisit(node ast.Node) bool {
+	return !helper.FromProtocolPosition(v.pos).IsBefore(node.GetRange().Start)
+}
+
+func (v *signatureVisitor) VisitFuncCall(call *ast.FuncCall) ast.VisitResult {
+	if call.Func != nil && helper.IsInRange(call.Range, v.pos) {
+		v.call = call
+	}
+	return ast.VisitRecurse
+}
+
+func (v *signatureVisitor) VisitBadDecl(d *ast.BadDecl) ast.VisitResult {
+	v.visitBad(d)
+	return ast.VisitRecurse
+}
+
+func (v *signatureVisitor) VisitBadStmt(s *ast.BadStmt) ast.VisitResult {
+	v.visitBad(s)
+	return ast.VisitRecurse
+}
+
+func (v *signatureVisitor) VisitBadExpr(e *ast.BadExpr) ast.VisitResult {
+	v.visitBad(e)
+	return ast.VisitRecurse
+}
+
+func (v *signatureVisitor) visitBad(node ast.Node) {
+	if start := node.GetRange().Start; !v.inError || v.errorStart.IsBefore(start) {
+		v.errorStart, v.inError = start, true
+	}
+}
+
+// returns the alias that call was written with and the index of the alias token
+// of the argument at pos, or -1 if pos is not at an argument
+// the alias is the one whose parameters are in the order of the arguments
+func callAlias(call *ast.FuncCall, pos protocol.Position) (ast.Alias, int) {
+	type arg struct {
+		name string
+		rang token.Range
+	}
+	args := make([]arg, 0, len(call.Args))
+	for name, expr := range call.Args {
+		// default values are not part of the call
+		if expr != nil && rangeContains(call.Range, expr.GetRange()) {
+			args = append(args, arg{name, expr.GetRange()})
+		}
+	}
+	sort.Slice(args, func(i, j int) bool {
+		return args[i].rang.Start.IsBefore(args[j].rang.Start)
+	})
+
+	var alias ast.Alias
+	for _, funcAlias := range call.Func.Aliases {
+		params := make([]string, 0, len(args))
+		for _, tok := range aliasWithoutEOF(funcAlias) {
+			if tok.Type == token.ALIAS_PARAMETER {
+				params = append(params, aliasParamName(tok))
+			}
+		}
+		if slices.EqualFunc(params, args, func(param string, arg arg) bool { return param == arg.name }) {
+			alias = funcAlias
+			break
+		}
+	}
+	if alias == nil {
+		return nil, -1
+	}
+
+	// the argument at pos or the next one behind it
+	active := ""
+	for _, arg := range args {
+		if helper.IsInRange(arg.rang, pos) || helper.FromProtocolPosition(pos).IsBefore(arg.rang.Start) {
+			active = arg.name
+			break
+		}
+	}
+	for i, tok := range aliasWithoutEOF(alias) {
+		if tok.Type == token.ALIAS_PARAMETER && aliasParamName(tok) == active {
+			return alias, i
+		}
+	}
+	return alias, -1
+}
+
+// scans the given source and returns the tokens of
+// the sentence that is not yet finished at the end of it
+// partial is true if the last token may be incomplete
+func currentSentence(source string) (typed []token.Token, partial bool) {
+	tokens, err := scanner.Scan(scanner.Options{
+		FileName:    "Signatur",
+		Source:      []byte(source),
+		ScannerMode: scanner.ModeNone,
+	})
+	if err != nil {
+		return nil, false
+	}
+
+	typed = make([]token.Token, 0, 16)
+	for _, tok := range tokens {
+		switch tok.Type {
+		case token.DOT, token.COLON:
+			typed = typed[:0]
+		case token.COMMENT, token.EOF:
+		default:
+			typed = append(typed, tok)
+		}
+	}
+
+	lastRune, _ := utf8.DecodeLastRuneInString(source)
+	return typed, len(source) > 0 && !unicode.IsSpace(lastRune)
+}
+
+func aliasWithoutEOF(alias ast.Alias) []token.Token {
+	tokens := alias.GetTokens()
+	if len(tokens) > 0 && tokens[len(tokens)-1].Type == token.EOF {
+		tokens = tokens[:len(tokens)-1]
+	}
+	return tokens
+}
+
+// matches the typed tokens as prefix of the alias tokens
+// every alias parameter consumes at least one typed token
+// returns the index of the parameter token that is being filled (or -1)
+func matchAliasPrefix(aliasTokens, typed []token.Token, partial bool) (int, bool) {
+	// lastParam is either -1 or i-1, so the results are memoized per (i, j, lastParam != -1)
+	// to not try the same split of the typed tokens between parameters more than once
+	type key struct {
+		i, j       int
+		afterParam bool
+	}
+	type result struct {
+		active int
+		ok     bool
+	}
+	memo := make(map[key]result)
+
+	var match func(i, j, lastParam int) (int, bool)
+	match = func(i, j, lastParam int) (int, bool) {
+		k := key{i, j, lastParam != -1}
+		if r, ok := memo[k]; ok {
+			return r.active, r.ok
+		}
+		active, ok := matchAt(i, j, lastParam, aliasTokens, typed, partial, match)
+		memo[k] = result{active, ok}
+		return active, ok
+	}
+
+	return match(0, 0, -1)
+}
+
+// one step of matchAliasPrefix, match is called for the rest of the tokens
+func matchAt(i, j, lastParam int, aliasTokens, typed []token.Token, partial bool, match func(i, j, lastParam int) (int, bool)) (int, bool) {
+	if j == len(typed) {
+		if i < len(aliasTokens) && aliasTokens[i].Type == token.ALIAS_PARAMETER && (lastParam == -1 || !partial) {
+			return i, true
+		}
+		return lastParam, true
+	}
+
+	if i == len(aliasTokens) {
+		return -1, false
+	}
+
+	if aliasTokens[i].Type == token.ALIAS_PARAMETER {
+		for k := j + 1; k <= len(typed); k++ {
+			if active, ok := match(i+1, k, i); ok {
+				return active, true
+			}
+		}
+		return -1, false
+	}
+
+	aliasLit, typedLit := aliasTokens[i].Literal, typed[j].Literal
+	if strings.EqualFold(aliasLit, typedLit) ||
+		(partial && j == len(typed)-1 && strings.HasPrefix(strings.ToLower(aliasLit), strings.ToLower(typedLit))) {
+		return match(i+1, j+1, -1)
+	}
+	return -1, false
+}
+
+func aliasParamName(tok token.Token) string {
+	return strings.TrimPrefix(strings.Trim(tok.Literal, "<>"), "*")
+}
+
+func aliasToSignature(alias ast.Alias, aliasTokens []token.Token, active int) protocol.SignatureInformation {
+	original := alias.GetOriginal()
+	signature := protocol.SignatureInformation{
+		Label:      ast.TrimStringLit(&original),
+		Parameters: make([]protocol.ParameterInformation, 0, len(alias.GetArgs())),
+	}
+
+	documentation := trimComment(alias.Decl().Comment())
+	if funcDecl, ok := alias.Decl().(*ast.FuncDecl); ok && funcDecl.ReturnType != nil && !ddptypes.IsVoid(funcDecl.ReturnType) {
+		documentation = strings.TrimSpace(fmt.Sprintf("gibt %s zurück\n\n%s", funcDecl.ReturnType, documentation))
+	}
+	if documentation != "" {
+		signature.Documentation = documentation
+	}
+
+	args := alias.GetArgs()
+	for i, tok := range aliasTokens {
+		if tok.Type != token.ALIAS_PARAMETER {
+			continue
+		}
+
+		if i == active {
+			signature.ActiveParameter = ptr(protocol.UInteger(len(signature.Parameters)))
+		}
+
+		param := protocol.ParameterInformation{
+			Label: tok.Literal,
+		}
+		if typ, ok := args[aliasParamName(tok)]; ok && typ.Type != nil {
+			param.Documentation = fmt.Sprintf("%s: %s", aliasParamName(tok), typ)
+		}
+		signature.Parameters = append(signature.Parameters, param)
+	}
+
+	return signature
+}
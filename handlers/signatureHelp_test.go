@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DDP-Projekt/DDPLS/documents"
+	"github.com/DDP-Projekt/Kompilierer/src/token"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func TestSignatureHelp(t *testing.T) {
+	const docUri = "file:///signature_help_test.ddp"
+	const declaration = `Die Funktion addiere mit den Parametern a und b vom Typ Zahl und Zahl, gibt eine Zahl zurück, macht:
+	Gib a plus b zurück.
+Und kann so benutzt werden:
+	"die Summe von <a> und <b>"
+`
+	tests := []struct {
+		line   string
+		cursor int // in the line, -1 is the end
+		label  string
+		active int // the active parameter, -1 if none
+	}{
+		{"Die Zahl z ist die Summe von 1 und 2.", 29, "die Summe von <a> und <b>", 0},
+		{"Die Zahl z ist die Summe von 1 und 2.", 36, "die Summe von <a> und <b>", 1},
+		{"Die Zahl z ist die Summe von 1 und 22.", 36, "die Summe von <a> und <b>", 1},
+		{"Die Zahl z ist die Summe von 1 und (die Summe von 2 und 3).", 56, "die Summe von <a> und <b>", 1},
+		{"Die Zahl z ist die Summe von 1 und ", -1, "die Summe von <a> und <b>", 1},
+		{"Die Zahl z ist die Summe von ", -1, "die Summe von <a> und <b>", 0},
+		{"Die Zahl z ist 1.", -1, "", -1},
+	}
+	for _, test := range tests {
+		dm := documents.NewDocumentManager()
+		if err := dm.AddAndParse(docUri, 1, declaration+test.line); err != nil {
+			t.Fatal(err)
+		}
+
+		cursor := test.cursor
+		if cursor == -1 {
+			cursor = len(test.line)
+		}
+		help, err := CreateTextDocumentSignatureHelp(dm)(&glsp.Context{}, &protocol.SignatureHelpParams{
+			TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: docUri},
+				Position:     protocol.Position{Line: 4, Character: protocol.UInteger(cursor)},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if test.label == "" {
+			if help != nil {
+				t.Errorf("%q at %d: got %v, want no signature", test.line, cursor, help.Signatures)
+			}
+			continue
+		}
+		if help == nil || len(help.Signatures) == 0 {
+			t.Errorf("%q at %d: got no signature, want %s", test.line, cursor, test.label)
+			continue
+		}
+
+		signature := help.Signatures[0]
+		active := -1
+		if signature.ActiveParameter != nil {
+			active = int(*signature.ActiveParameter)
+		}
+		if signature.Label != test.label || active != test.active {
+			t.Errorf("%q at %d: got %s with parameter %d, want %s with parameter %d", test.line, cursor, signature.Label, active, test.label, test.active)
+		}
+	}
+}
+
+func TestMatchAliasPrefix(t *testing.T) {
+	tokens := func(words string) []token.Token {
+		result := make([]token.Token, 0)
+		for _, word := range strings.Fields(words) {
+			typ := token.IDENTIFIER
+			if strings.HasPrefix(word, "<") {
+				typ = token.ALIAS_PARAMETER
+			}
+			result = append(result, token.Token{Type: typ, Literal: word})
+		}
+		return result
+	}
+
+	aliasTokens := tokens("die Summe von <a> und <b>")
+	tests := []struct {
+		typed   string
+		partial bool
+		active  int
+		ok      bool
+	}{
+		{"die Summe von", false, 3, true},
+		{"die Summe von 1", true, 3, true},
+		{"die Summe von 1 und", false, 5, true},
+		{"die Summe von 1 2 3 und 4", true, 5, true},
+		{"die Sum", true, -1, true},
+		{"Die summe VON", false, 3, true},
+		{"der Summe", false, -1, false},
+		{"die Summe von 1 und 2 und 3 und", false, 5, true},
+	}
+	for _, test := range tests {
+		active, ok := matchAliasPrefix(aliasTokens, tokens(test.typed), test.partial)
+		if active != test.active || ok != test.ok {
+			t.Errorf("%q (partial %v): got %d, %v, want %d, %v", test.typed, test.partial, active, ok, test.active, test.ok)
+		}
+	}
+
+	// memoization keeps aliases with many parameters fast
+	manyParams := strings.Repeat("<p> x ", 30) + "ende"
+	typed := strings.Repeat("y ", 60) + "x"
+	start := time.Now()
+	matchAliasPrefix(tokens(manyParams), tokens(typed), false)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("matching took %s", elapsed)
+	}
+}
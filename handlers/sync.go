@@ -10,7 +10,7 @@ import (
 
 func CreateTextDocumentDidOpen(dm *documents.DocumentManager, sendDiagnostics DiagnosticSender) protocol.TextDocumentDidOpenFunc {
 	return RecoverErr(func(context *glsp.Context, params *protocol.DidOpenTextDocumentParams) error {
-		err := dm.AddAndParse(params.TextDocument.URI, params.TextDocument.Text)
+		err := dm.AddAndParse(params.TextDocument.URI, params.TextDocument.Version, params.TextDocument.Text)
 		if err != nil {
 			return fmt.Errorf("error while parsing module %s: %s", params.TextDocument.URI, err)
 		}
@@ -21,32 +21,29 @@ func CreateTextDocumentDidOpen(dm *documents.DocumentManager, sendDiagnostics Di
 
 func CreateTextDocumentDidChange(dm *documents.DocumentManager, sendDiagnostics DiagnosticSender) protocol.TextDocumentDidChangeFunc {
 	return RecoverErr(func(context *glsp.Context, params *protocol.DidChangeTextDocumentParams) error {
-		doc, ok := dm.Get(params.TextDocument.URI)
-		if !ok {
-			return fmt.Errorf("%s not in document map", params.TextDocument.URI)
-		}
+		// the documents that import doc are reparsed as well
+		changes := make([]documents.ContentChange, 0, len(params.ContentChanges))
 		for _, change := range params.ContentChanges {
 			switch change := change.(type) {
 			case protocol.TextDocumentContentChangeEvent:
-				startIndex, endIndex := change.Range.IndexesIn(doc.Content)
-				doc.Content = doc.Content[:startIndex] + change.Text + doc.Content[endIndex:]
+				changes = append(changes, documents.ContentChange{Range: change.Range, Text: change.Text})
 			case protocol.TextDocumentContentChangeEventWhole:
-				doc.Content = change.Text
+				changes = append(changes, documents.ContentChange{Text: change.Text})
 			}
-			doc.NeedReparse.Store(true)
+		}
+		err := dm.ApplyChanges(params.TextDocument.URI, params.TextDocument.Version, changes)
+		if err != nil {
+			return err
 		}
 		sendDiagnostics(dm, context.Notify, params.TextDocument.URI, true)
 		return nil
 	})
 }
 
-func TextDocumentDidSave(*glsp.Context, *protocol.DidSaveTextDocumentParams) error {
-	return nil
-}
-
-func CreateTextDocumentDidClose(dm *documents.DocumentManager) protocol.TextDocumentDidCloseFunc {
+func CreateTextDocumentDidClose(dm *documents.DocumentManager, semanticTokens *SemanticTokensCache) protocol.TextDocumentDidCloseFunc {
 	return RecoverErr(func(context *glsp.Context, params *protocol.DidCloseTextDocumentParams) error {
 		dm.Delete(params.TextDocument.URI)
+		semanticTokens.Delete(params.TextDocument.URI)
 		return nil
 	})
 }
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"path/filepath"
+	"sort"
+
+	"github.com/DDP-Projekt/DDPLS/documents"
+	"github.com/DDP-Projekt/DDPLS/helper"
+	"github.com/DDP-Projekt/DDPLS/uri"
+	"github.com/DDP-Projekt/Kompilierer/src/ast"
+	"github.com/DDP-Projekt/Kompilierer/src/token"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// maximum number of symbols returned for a single query
+const maxWorkspaceSymbols = 256
+
+func CreateWorkspaceSymbol(dm *documents.DocumentManager) protocol.WorkspaceSymbolFunc {
+	return RecoverAnyErr(func(context *glsp.Context, params *protocol.WorkspaceSymbolParams) ([]protocol.SymbolInformation, error) {
+		type scoredSymbol struct {
+			symbol protocol.SymbolInformation
+			score  int
+		}
+
+		// only the open documents are searched by their module,
+		// the indexed files by their summary, so that they do not have to be parsed
+		modules, uris := openModules(dm)
+
+		symbols := make([]scoredSymbol, 0, maxWorkspaceSymbols)
+		for _, mod := range modules {
+			docUri := moduleUri(uris, mod)
+			container := mod.GetIncludeFilename()
+
+			for _, stmt := range mod.Ast.Statements {
+				declStmt, ok := stmt.(*ast.DeclStmt)
+				if !ok {
+					continue
+				}
+
+				nameTok, aliases, ok := workspaceSymbolInfo(declStmt.Decl)
+				if !ok {
+					continue
+				}
+
+				score, matched := helper.FuzzyMatch(params.Query, nameTok.Literal)
+				for _, alias := range aliases {
+					original := alias.GetOriginal()
+					if aliasScore, aliasMatched := helper.FuzzyMatch(params.Query, ast.TrimStringLit(&original)); aliasMatched && (!matched || aliasScore > score) {
+						score, matched = aliasScore, true
+					}
+				}
+				if !matched {
+					continue
+				}
+
+				symbols = append(symbols, scoredSymbol{
+					symbol: protocol.SymbolInformation{
+						Name: nameTok.Literal,
+						Kind: symbolKind(declStmt.Decl),
+						Location: protocol.Location{
+							URI:   protocol.DocumentUri(docUri),
+							Range: helper.ToProtocolRange(nameTok.Range),
+						},
+						ContainerName: &container,
+					},
+					score: score,
+				})
+			}
+		}
+
+		for _, summary := range dm.IndexedSummaries() {
+			if _, isOpen := uris[summary.FileName]; isOpen {
+				continue
+			}
+			container := filepath.Base(summary.FileName)
+
+			for _, decl := range summary.Declarations {
+				if !decl.Public && (decl.Kind == documents.DeclKindVar || decl.Kind == documents.DeclKindConst) {
+					continue
+				}
+
+				score, matched := helper.FuzzyMatch(params.Query, decl.Name)
+				for _, alias := range decl.Aliases {
+					if aliasScore, aliasMatched := helper.FuzzyMatch(params.Query, alias); aliasMatched && (!matched || aliasScore > score) {
+						score, matched = aliasScore, true
+					}
+				}
+				if !matched {
+					continue
+				}
+
+				symbols = append(symbols, scoredSymbol{
+					symbol: protocol.SymbolInformation{
+						Name: decl.Name,
+						Kind: declKindToSymbolKind[decl.Kind],
+						Location: protocol.Location{
+							URI:   protocol.DocumentUri(uri.FromPath(summary.FileName)),
+							Range: helper.ToProtocolRange(decl.Range),
+						},
+						ContainerName: &container,
+					},
+					score: score,
+				})
+			}
+		}
+
+		sort.SliceStable(symbols, func(i, j int) bool {
+			return symbols[i].score > symbols[j].score
+		})
+
+		// only the returned symbols are encoded, so that not every file has to be read
+		enc := newEncoder(dm)
+		result := make([]protocol.SymbolInformation, 0, min(len(symbols), maxWorkspaceSymbols))
+		for i := 0; i < len(symbols) && i < maxWorkspaceSymbols; i++ {
+			symbol := symbols[i].symbol
+			symbol.Location = enc.location(symbol.Location)
+			result = append(result, symbol)
+		}
+		return result, nil
+	})
+}
+
+// the symbol kinds of the declarations in a documents.ModuleSummary
+// matches symbolKind
+var declKindToSymbolKind = map[documents.DeclKind]protocol.SymbolKind{
+	documents.DeclKindVar:       protocol.SymbolKindVariable,
+	documents.DeclKindConst:     protocol.SymbolKindConstant,
+	documents.DeclKindFunc:      protocol.SymbolKindFunction,
+	documents.DeclKindOperator:  protocol.SymbolKindOperator,
+	documents.DeclKindStruct:    protocol.SymbolKindStruct,
+	documents.DeclKindTypeDef:   protocol.SymbolKindClass,
+	documents.DeclKindTypeAlias: protocol.SymbolKindTypeParameter,
+}
+
+// returns the modules of all open documents
+// and their uris by module filename
+func openModules(dm *documents.DocumentManager) ([]*ast.Module, map[string]uri.URI) {
+	uris := make(map[string]uri.URI)
+	modules := make([]*ast.Module, 0)
+	for _, doc := range dm.GetAll() {
+		if doc.Module != nil {
+			uris[doc.Module.FileName] = doc.Uri
+			modules = append(modules, doc.Module)
+		}
+	}
+	return modules, uris
+}
+
+// returns the modules of all open documents and of the indexed files that might reference
+// declarations of the file at path (see DocumentManager.IndexedModulesReferencing)
+// and the uris of the open documents by module filename
+// open documents take precedence over their version on disk
+func workspaceModules(dm *documents.DocumentManager, path string) ([]*ast.Module, map[string]uri.URI) {
+	modules, uris := openModules(dm)
+	for _, mod := range dm.IndexedModulesReferencing(path) {
+		if _, isOpen := uris[mod.FileName]; !isOpen {
+			modules = append(modules, mod)
+		}
+	}
+	return modules, uris
+}
+
+// returns the uri of the open document of mod or the uri of its file
+func moduleUri(uris map[string]uri.URI, mod *ast.Module) protocol.DocumentUri {
+	if docUri, ok := uris[mod.FileName]; ok {
+		return protocol.DocumentUri(docUri)
+	}
+	return protocol.DocumentUri(uri.FromPath(mod.FileName))
+}
+
+// returns the name token and aliases of declarations
+// that should be found by workspace/symbol
+func workspaceSymbolInfo(decl ast.Declaration) (token.Token, []ast.Alias, bool) {
+	switch decl := decl.(type) {
+	case *ast.FuncDecl:
+		aliases := make([]ast.Alias, 0, len(decl.Aliases))
+		for _, alias := range decl.Aliases {
+			aliases = append(aliases, alias)
+		}
+		return decl.NameTok, aliases, true
+	case *ast.StructDecl:
+		aliases := make([]ast.Alias, 0, len(decl.Aliases))
+		for _, alias := range decl.Aliases {
+			aliases = append(aliases, alias)
+		}
+		return decl.NameTok, aliases, true
+	case *ast.TypeDefDecl:
+		return decl.NameTok, nil, true
+	case *ast.TypeAliasDecl:
+		return decl.NameTok, nil, true
+	case *ast.VarDecl:
+		return decl.NameTok, nil, decl.IsPublic
+	case *ast.ConstDecl:
+		return decl.NameTok, nil, decl.IsPublic
+	}
+	return token.Token{}, nil, false
+}
@@ -0,0 +1,60 @@
+package helper
+
+import (
+	"strings"
+	"unicode"
+)
+
+// matches query as case-insensitive subsequence of candidate
+// returns wether it matched and a score (higher is better)
+// consecutive characters and characters at the start of a word score higher
+func FuzzyMatch(query, candidate string) (int, bool) {
+	queryRunes := []rune(query)
+	if len(queryRunes) == 0 {
+		return 0, true
+	}
+
+	score, qi, lastMatch := 0, 0, -2
+	prev := ' '
+	for ci, r := range []rune(candidate) {
+		if qi < len(queryRunes) && unicode.ToLower(r) == unicode.ToLower(queryRunes[qi]) {
+			score++
+			if lastMatch == ci-1 {
+				score += 2
+			}
+			if !unicode.IsLetter(prev) && !unicode.IsDigit(prev) {
+				score += 3
+			}
+			lastMatch = ci
+			qi++
+		}
+		prev = r
+	}
+
+	if qi != len(queryRunes) {
+		return 0, false
+	}
+	return score, true
+}
+
+// returns the case-insensitive levenshtein distance between a and b
+func EditDistance(a, b string) int {
+	aRunes, bRunes := []rune(strings.ToLower(a)), []rune(strings.ToLower(b))
+	prev, cur := make([]int, len(bRunes)+1), make([]int, len(bRunes)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(aRunes); i++ {
+		cur[0] = i
+		for j := 1; j <= len(bRunes); j++ {
+			cost := 1
+			if aRunes[i-1] == bRunes[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(bRunes)]
+}
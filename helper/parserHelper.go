@@ -15,6 +15,20 @@ func GetAliasParamProtocolRange(aliasToken token.Token) protocol.Range {
 	})
 }
 
+// the ranges of alias tokens start one column before the token in the source
+func GetAliasTokenProtocolRange(aliasToken token.Token) protocol.Range {
+	return ToProtocolRange(token.Range{
+		Start: token.Position{
+			Line:   aliasToken.Range.Start.Line,
+			Column: aliasToken.Range.Start.Column + 1,
+		},
+		End: token.Position{
+			Line:   aliasToken.Range.End.Line,
+			Column: aliasToken.Range.End.Column + 1,
+		},
+	})
+}
+
 func AliasParamNameEquals(t1 token.Token, name string) bool {
 	return t1.Type == token.ALIAS_PARAMETER && t1.Literal == "<"+name+">"
 }
@@ -1,9 +1,6 @@
 package helper
 
 import (
-	"strings"
-	"unicode/utf8"
-
 	"github.com/DDP-Projekt/DDPLS/documents"
 	"github.com/DDP-Projekt/Kompilierer/src/token"
 	protocol "github.com/tliron/glsp/protocol_3_16"
@@ -50,18 +47,12 @@ func FromProtocolPosition(pos protocol.Position) token.Position {
 	}
 }
 
-// returns the length of a token.Range
+// returns the length of a token.Range in runes, without line breaks
 func GetRangeLength(rang token.Range, doc *documents.DocumentState) int {
 	if rang.Start.Line == rang.End.Line {
 		return int(rang.End.Column - rang.Start.Column)
 	}
-	lines := strings.Split(doc.Content, "\n")
-	length := utf8.RuneCountInString(lines[rang.Start.Line-1][rang.Start.Column-1:])
-	for i := rang.Start.Line; i < rang.End.Line-1; i++ {
-		length += utf8.RuneCountInString(lines[i])
-	}
-	length += utf8.RuneCountInString(lines[rang.End.Line-1][:rang.End.Column-1])
-	return length
+	return doc.Lines.Length(rang, documents.PositionEncodingUTF32)
 }
 
 // returns two new ranges, constructed by cutting innerRange out of wholeRange
@@ -3,10 +3,13 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"os"
 	"runtime/pprof"
 
 	"github.com/DDP-Projekt/DDPLS/ddpls"
+	"github.com/DDP-Projekt/DDPLS/documents"
+	"github.com/DDP-Projekt/DDPLS/handlers"
 	"github.com/DDP-Projekt/DDPLS/log"
 	logging "github.com/tliron/commonlog"
 
@@ -19,6 +22,13 @@ func main() {
 	flag.StringVar(&cpuprofile, "cpuprofile", "", "write cpu profile to file")
 	flag.Parse()
 
+	switch flag.Arg(0) {
+	case "fmt":
+		os.Exit(runFmt(flag.Args()[1:]))
+	case "cache":
+		os.Exit(runCache(flag.Args()[1:]))
+	}
+
 	// This increases logging verbosity (optional)
 	logging.Configure(1, nil)
 
@@ -38,5 +48,66 @@ func main() {
 		}
 	}
 
-	ls.Server.RunStdio()
+	ls.RunStdio()
+}
+
+// formats the given files
+// without -w the names of all files that are not formatted are printed
+// returns the exit code
+func runFmt(args []string) int {
+	fmtFlags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	write := fmtFlags.Bool("w", false, "write the formatted source back to the files")
+	fmtFlags.Usage = func() {
+		fmt.Fprintln(fmtFlags.Output(), "usage: ddpls fmt [-w] files...")
+		fmtFlags.PrintDefaults()
+	}
+	fmtFlags.Parse(args)
+
+	exitCode := 0
+	for _, path := range fmtFlags.Args() {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exitCode = 2
+			continue
+		}
+
+		formatted, err := handlers.FormatSource(path, string(content), nil, "\t")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+			exitCode = 2
+			continue
+		}
+		if formatted == string(content) {
+			continue
+		}
+
+		if !*write {
+			fmt.Println(path)
+			exitCode = max(exitCode, 1)
+			continue
+		}
+
+		if err := os.WriteFile(path, []byte(formatted), 0o644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exitCode = 2
+		}
+	}
+	return exitCode
+}
+
+// manages the on-disk cache of the workspace index
+// returns the exit code
+func runCache(args []string) int {
+	if len(args) != 1 || args[0] != "clean" {
+		fmt.Fprintln(os.Stderr, "usage: ddpls cache clean")
+		return 2
+	}
+
+	if err := documents.CleanCache(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("removed %s\n", documents.CacheDir())
+	return 0
 }